@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ackRepos records the current status of each named repo so it is left out
+// of reports until that status changes, for repos left diverged on purpose
+func ackRepos(names []string) {
+	if len(names) == 0 {
+		printUsage()
+		return
+	}
+	err := checkPlaintext(statePath())
+	if err != nil {
+		fmt.Println("error saving state:", err.Error())
+		os.Exit(1)
+	}
+	for _, name := range names {
+		path := findRegistered(name)
+		if path == "" {
+			fmt.Println(name, "is not registered")
+			os.Exit(1)
+		}
+		status := getStatus(path)
+		switch {
+		case status.Acknowledged:
+			fmt.Println(status.Name, "is already acknowledged")
+		case !status.ShouldReport:
+			fmt.Println(status.Name, "has nothing to acknowledge")
+		default:
+			stateLock.Lock()
+			loadState()
+			state.Acks[path] = newAck(status)
+			stateDirty = true
+			stateLock.Unlock()
+			fmt.Println(status.Name, "acknowledged while it stays", summarizeStatus(status))
+		}
+	}
+	saveState()
+}
+
+// Ack is the status a repo was acknowledged in, summarized separately for
+// what the remote and worktree checks found so a run that skips one of them
+// compares the rest
+type Ack struct {
+	Remote   string `json:"remote,omitempty"`
+	Worktree string `json:"worktree,omitempty"`
+	Other    string `json:"other,omitempty"`
+}
+
+// UnmarshalJSON reads acks saved as a single summary by older versions,
+// which are matched against the whole status
+func (ack *Ack) UnmarshalJSON(raw []byte) error {
+	var summary string
+	if json.Unmarshal(raw, &summary) == nil {
+		*ack = Ack{Other: summary}
+		return nil
+	}
+	type plain Ack
+	return json.Unmarshal(raw, (*plain)(ack))
+}
+
+// newAck splits a status by check. PR readiness is left out as it needs
+// both checks and otherwise follows from the unpushed count and time.
+func newAck(status RepoStatus) Ack {
+	remote := RepoStatus{ShouldReport: true, RemoteBranchError: status.RemoteBranchError,
+		Unpushed: status.Unpushed, Unpulled: status.Unpulled,
+		RemoteUnreachable: status.RemoteUnreachable, AuthRequired: status.AuthRequired}
+	worktree := RepoStatus{ShouldReport: true, Deltas: status.Deltas, ModeChanges: status.ModeChanges,
+		LineEndings: status.LineEndings, CaseRenames: status.CaseRenames}
+	other := status
+	other.RemoteBranchError, other.Unpushed, other.Unpulled = false, 0, 0
+	other.RemoteUnreachable, other.AuthRequired = false, false
+	other.Deltas, other.ModeChanges, other.LineEndings, other.CaseRenames = 0, 0, 0, 0
+	other.PRReady = false
+	return Ack{Remote: summarizeStatus(remote), Worktree: summarizeStatus(worktree), Other: summarizeStatus(other)}
+}
+
+// matches compares the parts of a status that this run checked
+func (ack Ack) matches(status RepoStatus) bool {
+	if ack.Remote == "" && ack.Worktree == "" {
+		// Saved by an older version, or nothing but the other checks flagged
+		return ack.Other == summarizeStatus(status)
+	}
+	current := newAck(status)
+	return ack.Other == current.Other &&
+		(!config.Checks.Remote || ack.Remote == current.Remote) &&
+		(!config.Checks.Worktree || ack.Worktree == current.Worktree)
+}
+
+// applyAck hides a flagged status that matches what was acknowledged, and
+// forgets the acknowledgement once the status moves on. A run that skipped
+// the remote or worktree checks can't tell, so it keeps the acknowledgement.
+func applyAck(status *RepoStatus) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	loadState()
+	acked, ok := state.Acks[status.Path]
+	if !ok {
+		return
+	}
+	if status.ShouldReport && acked.matches(*status) {
+		status.Acknowledged = true
+		status.ShouldReport = false
+		return
+	}
+	if !config.Checks.Remote || !config.Checks.Worktree {
+		return
+	}
+	delete(state.Acks, status.Path)
+	stateDirty = true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyAck(t *testing.T) {
+	acked := RepoStatus{Path: "/src/app", ShouldReport: true, Unpulled: 2, Deltas: 1, Stashes: 1}
+	moved := acked
+	moved.Unpulled = 3
+	tests := []struct {
+		name             string
+		status           RepoStatus
+		noRemote         bool
+		noWorktree       bool
+		wantAcknowledged bool
+		wantKept         bool
+	}{
+		{"unchanged", acked, false, false, true, true},
+		{"moved on", moved, false, false, false, false},
+		{"clean", RepoStatus{Path: "/src/app"}, false, false, false, false},
+		{"remote not checked", RepoStatus{Path: "/src/app", ShouldReport: true, Deltas: 1, Stashes: 1}, true, false, true, true},
+		{"worktree not checked", RepoStatus{Path: "/src/app", ShouldReport: true, Unpulled: 2, Stashes: 1}, false, true, true, true},
+		{"moved on without remote check", RepoStatus{Path: "/src/app", ShouldReport: true, Deltas: 2, Stashes: 1}, true, false, false, true},
+		{"clean without worktree check", RepoStatus{Path: "/src/app"}, false, true, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTempSettings(t)
+			config.Checks.Remote, config.Checks.Worktree = !test.noRemote, !test.noWorktree
+			loadState()
+			state.Acks[acked.Path] = newAck(acked)
+			status := test.status
+			applyAck(&status)
+			if status.Acknowledged != test.wantAcknowledged || status.ShouldReport == test.wantAcknowledged && test.status.ShouldReport {
+				t.Errorf("got acknowledged %t, reported %t", status.Acknowledged, status.ShouldReport)
+			}
+			if _, kept := state.Acks[acked.Path]; kept != test.wantKept {
+				t.Errorf("got ack kept %t, want %t", kept, test.wantKept)
+			}
+		})
+	}
+}
+
+func TestLegacyAck(t *testing.T) {
+	useTempSettings(t)
+	var saved State
+	if err := json.Unmarshal([]byte(`{"acks": {"/src/app": "↓2"}}`), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if !saved.Acks["/src/app"].matches(RepoStatus{ShouldReport: true, Unpulled: 2}) {
+		t.Errorf("legacy ack %+v doesn't match the status it was saved for", saved.Acks["/src/app"])
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getLastActivity finds when the repo was last touched: the newest commit
+// on a local branch, or the last update to HEAD's reflog from checkouts,
+// resets and the like. Fetches only update remote refs so they don't count.
+func getLastActivity(repo string) time.Time {
+	var last time.Time
+	raw, err := getCmdOutput(repo, "git", "for-each-ref", "--sort=-committerdate", "--count=1",
+		"--format=%(committerdate:unix)", "refs/heads")
+	if err == nil && raw != "" {
+		seconds, err := strconv.ParseInt(raw, 10, 64)
+		if err == nil {
+			last = time.Unix(seconds, 0)
+		}
+	}
+	reflog, err := os.Stat(filepath.Join(repo, ".git", "logs", "HEAD"))
+	if err == nil && reflog.ModTime().After(last) {
+		last = reflog.ModTime()
+	}
+	return last
+}
+
+func idleStatuses(repos []RepoStatus, idle time.Duration) []RepoStatus {
+	var idleRepos []RepoStatus
+	for _, repo := range repos {
+		if !repo.LastActivity.IsZero() && clock().Sub(repo.LastActivity) >= idle {
+			idleRepos = append(idleRepos, repo)
+		}
+	}
+	return idleRepos
+}
+
+func sortByActivity(repos []RepoStatus) {
+	sort.SliceStable(repos, func(i, j int) bool {
+		return repos[i].LastActivity.After(repos[j].LastActivity)
+	})
+}
+
+func printActivity(w io.Writer, repo RepoStatus) {
+	if repo.LastActivity.IsZero() {
+		return
+	}
+	fmt.Fprintf(w, "%s ", tr("%s ago", formatAge(clock().Sub(repo.LastActivity))))
+}
+
+// getDivergedSince is the commit date of the merge base with the upstream,
+// how long the branch has been drifting from it
+func getDivergedSince(repo string, remote string) time.Time {
+	base, err := getCmdOutput(repo, "git", "merge-base", "HEAD", remote)
+	if err != nil {
+		return time.Time{}
+	}
+	return getCommitTime(repo, base)
+}
+
+// getCommitTime is the committer date of a revision
+func getCommitTime(repo string, rev string) time.Time {
+	raw, err := getCmdOutput(repo, "git", "show", "-s", "--format=%ct", rev)
+	if err != nil {
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// printDrift shows how long a branch has diverged once it's been a day
+func printDrift(w io.Writer, repo RepoStatus) {
+	if repo.DivergedSince.IsZero() || clock().Sub(repo.DivergedSince) < 24*time.Hour {
+		return
+	}
+	fmt.Fprintf(w, "%s ", tr("for %s", formatAge(clock().Sub(repo.DivergedSince))))
+}
+
+// formatAge rounds a duration to its largest sensible unit, like 12d
+func formatAge(age time.Duration) string {
+	locale := locales[language]
+	switch {
+	case age >= 24*time.Hour:
+		return formatNumber(int(age/(24*time.Hour))) + locale.Days
+	case age >= time.Hour:
+		return strconv.Itoa(int(age/time.Hour)) + locale.Hours
+	default:
+		return strconv.Itoa(int(age/time.Minute)) + locale.Minutes
+	}
+}
+
+// getRelease describes HEAD as its latest tag and the commits since, like
+// v1.4.0+12, or nothing when there are no tags
+func getRelease(repo string) string {
+	raw, err := getCmdOutput(repo, "git", "describe", "--tags", "--long")
+	if err != nil {
+		return ""
+	}
+	// tag-count-gsha, where the tag may contain dashes itself
+	parts := strings.Split(raw, "-")
+	if len(parts) < 3 {
+		return ""
+	}
+	return strings.Join(parts[:len(parts)-2], "-") + "+" + parts[len(parts)-2]
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// assertClean exits non-zero when any repo, or any with the --tag given, is
+// dirty, ahead, behind or otherwise not a pristine checkout, so build
+// scripts can refuse to run from one. Tag rules like ignore_behind don't
+// apply here.
+func assertClean(tag string) {
+	var selected []string
+	if tag != "" {
+		selected = taggedPaths(tag)
+		if len(selected) == 0 {
+			fmt.Println("no registered repos are tagged", tag)
+			os.Exit(1)
+		}
+	} else {
+		for _, path := range registered {
+			if len(path) != 0 && !strings.HasPrefix(path, commentIndicator) && (!isArchived(path) || includeArchived) {
+				selected = append(selected, path)
+			}
+		}
+	}
+
+	failed := 0
+	for _, path := range selected {
+		var problems []string
+		if isUnavailable(path) {
+			problems = []string{"unavailable"}
+		} else if !isRepo(path) {
+			problems = []string{"not a repo"}
+		} else {
+			problems = getProblems(getStatus(path))
+		}
+		if len(problems) == 0 {
+			continue
+		}
+		failed++
+		fmt.Printf("%s: %s\n", path, strings.Join(problems, ", "))
+	}
+	if failed != 0 {
+		fmt.Printf("%d of %d repos are not clean\n", failed, len(selected))
+		os.Exit(1)
+	}
+	fmt.Printf("%d repos clean\n", len(selected))
+}
+
+// getProblems lists everything keeping a repo from being pristine
+func getProblems(repo RepoStatus) []string {
+	var problems []string
+	if repo.UnsafeOwnership {
+		problems = append(problems, "unsafe ownership")
+	}
+	if repo.Operation != "" {
+		problems = append(problems, repo.Operation+" in progress")
+	}
+	if repo.Empty {
+		problems = append(problems, "no commits")
+	}
+	if repo.Permissions != "" {
+		problems = append(problems, repo.Permissions)
+	}
+	if repo.Deltas < 0 {
+		// A repo git status failed on can't be vouched for
+		problems = append(problems, "error counting changes")
+	} else if repo.Deltas > 0 {
+		problems = append(problems, fmt.Sprintf("%d uncommitted changes", repo.Deltas))
+	}
+	if repo.Stashes > 0 {
+		problems = append(problems, fmt.Sprintf("%d stashes", repo.Stashes))
+	}
+	if repo.Detached != "" {
+		problems = append(problems, "detached HEAD")
+	}
+	if repo.RemoteBranchError {
+		problems = append(problems, "no upstream")
+	} else if repo.Unpushed < 0 || repo.Unpulled < 0 {
+		problems = append(problems, "error comparing with upstream")
+	}
+	if repo.Unpushed > 0 {
+		problems = append(problems, fmt.Sprintf("%d commits ahead", repo.Unpushed))
+	}
+	if repo.Unpulled > 0 {
+		problems = append(problems, fmt.Sprintf("%d commits behind", repo.Unpulled))
+	}
+	if repo.MissingRefs > 0 {
+		problems = append(problems, fmt.Sprintf("%d refs missing", repo.MissingRefs))
+	}
+	if repo.AuthRequired {
+		problems = append(problems, "auth required")
+	} else if repo.RemoteUnreachable {
+		problems = append(problems, "unreachable")
+	}
+	return problems
+}
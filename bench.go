@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cmdTimings collects how long each kind of command took while benchmarking,
+// it stays nil otherwise so normal runs don't pay for it
+var cmdTimings map[string][]time.Duration
+var cmdTimingsLock sync.Mutex
+
+func recordCmdTiming(start time.Time, name string, arg []string) {
+	key := name
+	if len(arg) != 0 {
+		key += " " + arg[0]
+	}
+	cmdTimingsLock.Lock()
+	cmdTimings[key] = append(cmdTimings[key], time.Since(start))
+	cmdTimingsLock.Unlock()
+}
+
+// runBench collects the registered repos runs times and prints latency
+// percentiles for each repo and each command it ran
+func runBench(runs int) {
+	cmdTimings = map[string][]time.Duration{}
+	repoTimings := map[string][]time.Duration{}
+	var totals []time.Duration
+
+	for run := 0; run < runs; run++ {
+		start := time.Now()
+		for _, path := range registered {
+			if len(path) == 0 || strings.HasPrefix(path, commentIndicator) || !isRepo(path) {
+				continue
+			}
+			if isArchived(path) && !includeArchived {
+				continue
+			}
+			repoStart := time.Now()
+			getStatus(path)
+			repoTimings[path] = append(repoTimings[path], time.Since(repoStart))
+		}
+		totals = append(totals, time.Since(start))
+	}
+	saveState()
+
+	fmt.Printf("%d runs\n\n", runs)
+	printTimings("run", map[string][]time.Duration{"total": totals})
+	fmt.Println()
+	printTimings("repo", repoTimings)
+	fmt.Println()
+	printTimings("command", cmdTimings)
+}
+
+func printTimings(label string, timings map[string][]time.Duration) {
+	var keys []string
+	width := len(label)
+	for key := range timings {
+		keys = append(keys, key)
+		if len(key) > width {
+			width = len(key)
+		}
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("%s %7s %9s %9s %9s %9s\n", padRight(label, width), "calls", "p50", "p90", "p99", "max")
+	for _, key := range keys {
+		durations := timings[key]
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		fmt.Printf("%s %7d %9s %9s %9s %9s\n", padRight(key, width), len(durations),
+			formatLatency(percentile(durations, 50)), formatLatency(percentile(durations, 90)),
+			formatLatency(percentile(durations, 99)), formatLatency(durations[len(durations)-1]))
+	}
+}
+
+// percentile picks the nearest rank from already sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(10 * time.Microsecond).String()
+}
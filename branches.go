@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gcBranches deletes the local branches that are already merged into each
+// repo's default branch. Every repo is listed first and nothing is deleted
+// without confirmation.
+func gcBranches() {
+	found := false
+	for _, path := range registered {
+		if len(path) == 0 || strings.HasPrefix(path, commentIndicator) {
+			continue
+		}
+		if !(gitBackend{}).Detect(path) || isUnsafeRepo(path) {
+			continue
+		}
+		base := getDefaultBranch(path)
+		if base == "" {
+			continue
+		}
+		merged := getMergedBranches(path, base)
+		if len(merged) == 0 {
+			continue
+		}
+		found = true
+
+		fmt.Printf("%s has %d branches merged into %s:\n", path, len(merged), base)
+		for _, branch := range merged {
+			fmt.Println("  " + branch)
+		}
+		if dryRun || !confirm("Delete them?") {
+			continue
+		}
+		_, err := getCmdOutput(path, "git", append([]string{"branch", "-D"}, merged...)...)
+		if err != nil {
+			fmt.Println("error deleting branches:", err.Error())
+		}
+	}
+	if !found {
+		fmt.Println("No merged branches to clean up")
+	}
+}
+
+// getDefaultBranch finds the branch work gets merged into, preferring what
+// the remote considers its HEAD over local guesses
+func getDefaultBranch(repo string) string {
+	remote := getUpstreamRemote(repo)
+	head, err := getCmdOutput(repo, "git", "symbolic-ref", "--short", "-q", "refs/remotes/"+remote+"/HEAD")
+	if err == nil && head != "" {
+		return head
+	}
+	for _, branch := range []string{"main", "master"} {
+		_, err = getCmdOutput(repo, "git", "rev-parse", "--verify", "-q", "refs/heads/"+branch)
+		if err == nil {
+			return branch
+		}
+	}
+	return ""
+}
+
+// getMergedBranches lists local branches fully merged into base, leaving out
+// the checked out branch and the local copy of base itself
+func getMergedBranches(repo string, base string) []string {
+	raw, err := getCmdOutput(repo, "git", "branch", "--merged", base, "--format=%(refname:short)")
+	if err != nil {
+		fmt.Println("error listing merged branches:", err.Error())
+		return nil
+	}
+	current, _ := getCmdOutput(repo, "git", "symbolic-ref", "--short", "-q", "HEAD")
+	baseName := base[strings.Index(base, "/")+1:]
+
+	var merged []string
+	for _, branch := range strings.Split(raw, "\n") {
+		if branch == "" || branch == current || branch == base || branch == baseName {
+			continue
+		}
+		merged = append(merged, branch)
+	}
+	return merged
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGcBranches(t *testing.T) {
+	useTempSettings(t)
+	repo := initRepo(t)
+	base := gitIn(t, repo, "symbolic-ref", "--short", "HEAD")
+	gitIn(t, repo, "branch", "done")
+	gitIn(t, repo, "checkout", "-q", "-b", "wip")
+	commitIn(t, repo, "unfinished")
+	gitIn(t, repo, "checkout", "-q", base)
+	registered = []string{repo}
+	previousDryRun, previousStdin := dryRun, stdin
+	t.Cleanup(func() { dryRun, stdin = previousDryRun, previousStdin })
+
+	if got := getDefaultBranch(repo); got != base {
+		t.Fatalf("got default branch %q, want %q", got, base)
+	}
+	if got := getMergedBranches(repo, base); !reflect.DeepEqual(got, []string{"done"}) {
+		t.Errorf("got merged %q, want only done", got)
+	}
+
+	branches := func() string {
+		return gitIn(t, repo, "branch", "--format=%(refname:short)")
+	}
+	all := branches()
+	tests := []struct {
+		name   string
+		dryRun bool
+		answer string
+		want   string
+	}{
+		{"dry run", true, "y\n", all},
+		{"declined", false, "\n", all},
+		{"confirmed", false, "y\n", strings.Join([]string{base, "wip"}, "\n")},
+	}
+	for _, test := range tests {
+		dryRun = test.dryRun
+		stdin = bufio.NewReader(strings.NewReader(test.answer))
+		gcBranches()
+		if got := branches(); got != test.want {
+			t.Errorf("%s: left %q, want %q", test.name, got, test.want)
+		}
+	}
+}
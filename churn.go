@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+)
+
+// getChurn counts the changes that are only line endings or only the case
+// of a file name, as left behind by syncing a repo across platforms
+func getChurn(repo string) (lineEndings int, caseRenames int) {
+	raw, err := getCmdOutput(repo, "git", "diff", "--numstat")
+	if err != nil {
+		return 0, 0
+	}
+	ignoringCR, err := getCmdOutput(repo, "git", "diff", "--numstat", "--ignore-cr-at-eol")
+	if err != nil {
+		return 0, 0
+	}
+	crOnly := map[string]bool{}
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) == 3 && fields[0]+fields[1] != "00" && fields[0] != "-" {
+			crOnly[fields[2]] = true
+		}
+	}
+	for _, line := range strings.Split(ignoringCR, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) == 3 && fields[0]+fields[1] != "00" {
+			delete(crOnly, fields[2])
+		}
+	}
+	lineEndings = len(crOnly)
+
+	// A rename that only changes case shows up as a deleted file and an
+	// untracked one whose names differ in case alone
+	status, err := getCmdOutput(repo, "git", "status", "--porcelain")
+	if err != nil {
+		return lineEndings, 0
+	}
+	var deleted, untracked []string
+	for _, line := range strings.Split(status, "\n") {
+		switch {
+		case strings.HasPrefix(line, "D "), strings.HasPrefix(line, " D "):
+			deleted = append(deleted, strings.TrimSpace(line[2:]))
+		case strings.HasPrefix(line, "?? "):
+			untracked = append(untracked, line[3:])
+		}
+	}
+	for _, old := range deleted {
+		for _, renamed := range untracked {
+			if old != renamed && strings.EqualFold(old, renamed) {
+				caseRenames++
+			}
+		}
+	}
+	return lineEndings, caseRenames
+}
+
+// isChurnOnly is true when every change is line endings or case renames. A
+// case rename counts twice in the deltas, once deleted and once untracked.
+func isChurnOnly(repo RepoStatus) bool {
+	churn := repo.LineEndings + 2*repo.CaseRenames
+	return churn > 0 && churn == repo.Deltas
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// printCompletionData lists each repo as name, path and comma separated
+// tags on a tab separated line, for pickers like fzf to jump to repos with.
+// Names come from the cache, so no git runs once it is warm.
+func printCompletionData() {
+	for _, path := range registered {
+		if len(path) == 0 || strings.HasPrefix(path, commentIndicator) {
+			continue
+		}
+		if isArchived(path) && !includeArchived {
+			continue
+		}
+		var tags []string
+		if repo, ok := config.Repos[path]; ok {
+			tags = repo.Tags
+		}
+		fmt.Printf("%s\t%s\t%s\n", getCachedRepoName(path), path, strings.Join(tags, ","))
+	}
+	saveState()
+}
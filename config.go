@@ -0,0 +1,1041 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Config x
+type Config struct {
+	Discovery DiscoveryConfig
+	Remote    RemoteConfig
+	Snapshot  SnapshotConfig
+	Outputs   []OutputConfig
+	Report    ReportConfig
+	Fetch     FetchConfig
+	Digest    DigestConfig
+	Branches  BranchesConfig
+	Server    ServerConfig
+	Store     StoreConfig
+	Checks    ChecksConfig
+	Telemetry TelemetryConfig
+	Repos     map[string]*RepoConfig
+	Tags      map[string]*TagConfig
+	Vars      map[string]string
+	Profiles  map[string]string
+}
+
+// DiscoveryConfig x
+type DiscoveryConfig struct {
+	Exclude    []string
+	MaxDepth   int
+	SkipNested bool
+}
+
+// RemoteConfig x
+type RemoteConfig struct {
+	Check   bool
+	Timeout time.Duration
+}
+
+// SnapshotConfig x
+type SnapshotConfig struct {
+	Enabled  bool
+	Path     string
+	History  bool
+	KeepRuns int
+	KeepDays int
+}
+
+// ReportConfig x
+type ReportConfig struct {
+	Title             string
+	Header            bool
+	Actions           bool
+	Theme             string
+	MaxBranchWidth    int
+	ShortBranch       bool
+	PRReadyAfter      time.Duration
+	IgnoreModeChanges bool
+	IgnoreUntracked   bool
+	Release           bool
+	Locale            string
+}
+
+// FetchConfig x
+type FetchConfig struct {
+	Timeout      time.Duration
+	SSHMultiplex bool
+}
+
+// DigestConfig x
+type DigestConfig struct {
+	Command string
+}
+
+// BranchesConfig x
+type BranchesConfig struct {
+	MaxUntracked int
+}
+
+// ServerConfig secures merge --listen with a bearer token, TLS, or client
+// certificates signed by ClientCA
+type ServerConfig struct {
+	Token    string
+	TLSCert  string
+	TLSKey   string
+	ClientCA string
+}
+
+// StoreConfig encrypts the registry for EncryptTo, gpg key ids or age
+// public keys. Identities are the age keys used to decrypt it. While it is
+// encrypted, files that would list repo paths in the clear are refused: the
+// snapshot, digest and file outputs, [repo] tables written to the config,
+// acks and snoozes, and the name cache is kept for the run only.
+type StoreConfig struct {
+	EncryptTo  []string
+	Identities []string
+}
+
+// ChecksConfig turns groups of checks off to make runs quicker, or on for
+// the opt-in ones
+type ChecksConfig struct {
+	Remote      bool
+	Worktree    bool
+	Churn       bool
+	Permissions bool
+	Owner       string
+}
+
+// TelemetryConfig opts in to recording aggregate counts about each run
+type TelemetryConfig struct {
+	Enabled bool
+}
+
+// RepoConfig holds the settings of a single registered repo. Alias replaces
+// the name taken from its remote and Branch is compared with instead of the
+// upstream.
+type RepoConfig struct {
+	Alias           string
+	Branch          string
+	Tags            []string
+	Archived        bool
+	Note            string
+	Remote          string
+	Ignore          []string
+	Pathspec        []string
+	Ref             string
+	IgnoreUntracked bool
+}
+
+// TagConfig holds the behavior shared by every repo with the tag
+type TagConfig struct {
+	IgnoreBehind bool
+	Fetch        bool
+	Ref          string
+}
+
+// TagRules is the combined behavior of all of a repo's tags
+type TagRules struct {
+	IgnoreBehind bool
+	Fetch        bool
+}
+
+var config = newConfig()
+
+func newConfig() Config {
+	return Config{
+		Report:   ReportConfig{Theme: "default", MaxBranchWidth: 40},
+		Snapshot: SnapshotConfig{KeepRuns: 500, KeepDays: 30},
+		Remote:   RemoteConfig{Timeout: 10 * time.Second},
+		Fetch:    FetchConfig{Timeout: time.Minute, SSHMultiplex: true},
+		Checks:   ChecksConfig{Remote: true, Worktree: true},
+		Repos:    map[string]*RepoConfig{},
+		Tags:     map[string]*TagConfig{},
+		Vars:     map[string]string{},
+		Profiles: map[string]string{},
+	}
+}
+
+func getTagRules(path string) (rules TagRules) {
+	repo, ok := config.Repos[path]
+	if !ok {
+		return rules
+	}
+	for _, tag := range repo.Tags {
+		if tagConfig, ok := config.Tags[tag]; ok {
+			rules.IgnoreBehind = rules.IgnoreBehind || tagConfig.IgnoreBehind
+			rules.Fetch = rules.Fetch || tagConfig.Fetch
+		}
+	}
+	return rules
+}
+
+// exitConfigError is the exit code for a config or registry that doesn't
+// validate, so scripts can tell it apart from other failures
+const exitConfigError = 3
+
+// ConfigErrors lists every problem found in a config, one per line
+type ConfigErrors []string
+
+func (errs ConfigErrors) Error() string {
+	return strings.Join(errs, "\n")
+}
+
+func loadConfig() {
+	loaded, err := readConfig(configFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(exitConfigError)
+	}
+	config = loaded
+}
+
+// readConfig parses a config file over the defaults, then applies any
+// GIT_STATUS_* overrides from the environment. A missing file is the same as
+// an empty one.
+func readConfig(file string) (Config, error) {
+	loaded := newConfig()
+	raw, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return loaded, fmt.Errorf("could not read config: %s", err.Error())
+	}
+	entries, err := parseToml(string(raw))
+	if err != nil {
+		return loaded, ConfigErrors{fmt.Sprintf("%s:%s", file, err.Error())}
+	}
+	// Every bad entry is reported, not just the first
+	var errs ConfigErrors
+	for _, entry := range entries {
+		err = loaded.apply(entry)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s:%d: %s: %s", file, entry.Line, entry.Name(), err.Error()))
+		}
+	}
+	errs = append(errs, loaded.applyEnv(os.Environ())...)
+	if len(errs) != 0 {
+		return loaded, errs
+	}
+	return loaded, nil
+}
+
+// configSections are the tables whose keys can be overridden from the
+// environment, GIT_STATUS_REPORT_MAX_BRANCH_WIDTH=30 standing for
+// report.max_branch_width = 30
+var configSections = []string{
+	"branches", "checks", "digest", "discovery", "fetch", "remote", "report", "server",
+	"snapshot", "store", "telemetry",
+}
+
+// applyEnv applies GIT_STATUS_<SECTION>_<KEY> variables over the config file.
+// Values are read like config set reads them. Variables for other sections,
+// like GIT_STATUS_STATE_DIR, are left alone.
+func (config *Config) applyEnv(environ []string) []string {
+	var errs []string
+	for _, variable := range environ {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "GIT_STATUS_") {
+			continue
+		}
+		name := strings.SplitN(strings.ToLower(strings.TrimPrefix(parts[0], "GIT_STATUS_")), "_", 2)
+		if len(name) != 2 || !contains(configSections, name[0]) {
+			continue
+		}
+		entry := tomlEntry{Table: name[:1], Index: -1, Key: name[1:], Value: tomlValue(parseConfigValue(parts[1]))}
+		err := config.apply(entry)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", parts[0], err.Error()))
+		}
+	}
+	return errs
+}
+
+func (config *Config) apply(entry tomlEntry) (err error) {
+	if len(entry.Table) == 1 && entry.Table[0] == "output" {
+		return config.applyOutput(entry)
+	}
+	if len(entry.Table) == 1 && entry.Table[0] == "profiles" && len(entry.Key) == 1 {
+		value, err := tomlString(entry.Value)
+		config.Profiles[entry.Key[0]] = value
+		return err
+	}
+	if len(entry.Table) == 1 && entry.Table[0] == "vars" && len(entry.Key) == 1 {
+		value, err := tomlString(entry.Value)
+		config.Vars[entry.Key[0]] = filepath.Clean(expandHome(value))
+		return err
+	}
+	if len(entry.Table) == 2 && entry.Table[0] == "repo" {
+		return config.applyRepo(entry)
+	}
+	if len(entry.Table) == 2 && entry.Table[0] == "tag" {
+		return config.applyTag(entry)
+	}
+
+	switch entry.Name() {
+	case "discovery.exclude":
+		config.Discovery.Exclude, err = tomlStrings(entry.Value)
+		for _, pattern := range config.Discovery.Exclude {
+			if err == nil {
+				_, err = compileGlob(pattern)
+			}
+		}
+	case "discovery.max_depth":
+		config.Discovery.MaxDepth, err = tomlInt(entry.Value)
+	case "discovery.skip_nested":
+		config.Discovery.SkipNested, err = tomlBool(entry.Value)
+	case "remote.check":
+		config.Remote.Check, err = tomlBool(entry.Value)
+	case "remote.timeout":
+		config.Remote.Timeout, err = tomlDuration(entry.Value)
+	case "snapshot.enabled":
+		config.Snapshot.Enabled, err = tomlBool(entry.Value)
+	case "snapshot.path":
+		config.Snapshot.Path, err = tomlString(entry.Value)
+		config.Snapshot.Path = expandHome(config.Snapshot.Path)
+	case "snapshot.history":
+		config.Snapshot.History, err = tomlBool(entry.Value)
+	case "snapshot.keep_runs":
+		config.Snapshot.KeepRuns, err = tomlInt(entry.Value)
+		if err == nil && config.Snapshot.KeepRuns < 0 {
+			err = fmt.Errorf("must not be negative")
+		}
+	case "snapshot.keep_days":
+		config.Snapshot.KeepDays, err = tomlInt(entry.Value)
+		if err == nil && config.Snapshot.KeepDays < 0 {
+			err = fmt.Errorf("must not be negative")
+		}
+	case "report.title":
+		config.Report.Title, err = tomlString(entry.Value)
+	case "report.header":
+		config.Report.Header, err = tomlBool(entry.Value)
+	case "report.actions":
+		config.Report.Actions, err = tomlBool(entry.Value)
+	case "report.short_branch":
+		config.Report.ShortBranch, err = tomlBool(entry.Value)
+	case "report.max_branch_width":
+		config.Report.MaxBranchWidth, err = tomlInt(entry.Value)
+		if err == nil && config.Report.MaxBranchWidth < 0 {
+			err = fmt.Errorf("must not be negative")
+		}
+	case "report.ignore_mode_changes":
+		config.Report.IgnoreModeChanges, err = tomlBool(entry.Value)
+	case "report.ignore_untracked":
+		config.Report.IgnoreUntracked, err = tomlBool(entry.Value)
+	case "report.locale":
+		config.Report.Locale, err = tomlString(entry.Value)
+	case "report.release":
+		config.Report.Release, err = tomlBool(entry.Value)
+	case "report.pr_ready_after":
+		config.Report.PRReadyAfter, err = tomlDuration(entry.Value)
+	case "report.theme":
+		config.Report.Theme, err = tomlString(entry.Value)
+		if _, ok := themes[config.Report.Theme]; err == nil && !ok {
+			err = fmt.Errorf("expected one of %s", strings.Join(themeNames(), ", "))
+		}
+	case "fetch.timeout":
+		config.Fetch.Timeout, err = tomlDuration(entry.Value)
+	case "fetch.ssh_multiplex":
+		config.Fetch.SSHMultiplex, err = tomlBool(entry.Value)
+	case "checks.remote":
+		config.Checks.Remote, err = tomlBool(entry.Value)
+	case "checks.worktree":
+		config.Checks.Worktree, err = tomlBool(entry.Value)
+	case "checks.churn":
+		config.Checks.Churn, err = tomlBool(entry.Value)
+	case "checks.permissions":
+		config.Checks.Permissions, err = tomlBool(entry.Value)
+	case "checks.owner":
+		config.Checks.Owner, err = tomlString(entry.Value)
+	case "telemetry.enabled":
+		config.Telemetry.Enabled, err = tomlBool(entry.Value)
+	case "digest.command":
+		config.Digest.Command, err = tomlString(entry.Value)
+	case "branches.max_untracked":
+		config.Branches.MaxUntracked, err = tomlInt(entry.Value)
+	case "store.encrypt_to":
+		config.Store.EncryptTo, err = tomlStrings(entry.Value)
+	case "store.identities":
+		config.Store.Identities, err = tomlStrings(entry.Value)
+		for i, identity := range config.Store.Identities {
+			config.Store.Identities[i] = expandHome(identity)
+		}
+	case "server.token":
+		config.Server.Token, err = tomlString(entry.Value)
+	case "server.tls_cert":
+		config.Server.TLSCert, err = tomlString(entry.Value)
+		config.Server.TLSCert = expandHome(config.Server.TLSCert)
+	case "server.tls_key":
+		config.Server.TLSKey, err = tomlString(entry.Value)
+		config.Server.TLSKey = expandHome(config.Server.TLSKey)
+	case "server.client_ca":
+		config.Server.ClientCA, err = tomlString(entry.Value)
+		config.Server.ClientCA = expandHome(config.Server.ClientCA)
+	default:
+		err = fmt.Errorf("unknown key")
+	}
+	return err
+}
+
+func (config *Config) applyOutput(entry tomlEntry) (err error) {
+	if entry.Index < 0 {
+		return fmt.Errorf("outputs must be declared with [[output]]")
+	}
+	for len(config.Outputs) <= entry.Index {
+		config.Outputs = append(config.Outputs, OutputConfig{Format: "table", Filter: "flagged"})
+	}
+	output := &config.Outputs[entry.Index]
+
+	switch strings.Join(entry.Key, ".") {
+	case "format":
+		output.Format, err = tomlString(entry.Value)
+		if err == nil && output.Format != "table" && output.Format != "json" {
+			err = fmt.Errorf("expected table or json")
+		}
+	case "path":
+		output.Path, err = tomlString(entry.Value)
+		output.Path = expandHome(output.Path)
+	case "url":
+		output.URL, err = tomlString(entry.Value)
+	case "filter":
+		output.Filter, err = tomlString(entry.Value)
+		if err == nil && output.Filter != "flagged" && output.Filter != "all" {
+			err = fmt.Errorf("expected flagged or all")
+		}
+	case "token":
+		output.Token, err = tomlString(entry.Value)
+	case "tls_cert":
+		output.TLSCert, err = tomlString(entry.Value)
+		output.TLSCert = expandHome(output.TLSCert)
+	case "tls_key":
+		output.TLSKey, err = tomlString(entry.Value)
+		output.TLSKey = expandHome(output.TLSKey)
+	case "ca":
+		output.CA, err = tomlString(entry.Value)
+		output.CA = expandHome(output.CA)
+	default:
+		err = fmt.Errorf("unknown key")
+	}
+	if err == nil && output.Path != "" && output.URL != "" {
+		err = fmt.Errorf("an output can't have both a path and a url")
+	}
+	return err
+}
+
+// applyRepo reads a [repo."/path/to/repo"] table
+func (config *Config) applyRepo(entry tomlEntry) (err error) {
+	path := filepath.Clean(expandHome(entry.Table[1]))
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("repo paths must be absolute")
+	}
+	repo, ok := config.Repos[path]
+	if !ok {
+		repo = &RepoConfig{}
+		config.Repos[path] = repo
+	}
+
+	switch strings.Join(entry.Key, ".") {
+	case "tags":
+		repo.Tags, err = tomlStrings(entry.Value)
+		for _, tag := range repo.Tags {
+			if err == nil && !isTagName(tag) {
+				err = fmt.Errorf("invalid tag %q, tags are single words", tag)
+			}
+		}
+	case "alias":
+		repo.Alias, err = tomlString(entry.Value)
+	case "branch":
+		repo.Branch, err = tomlString(entry.Value)
+	case "archived":
+		repo.Archived, err = tomlBool(entry.Value)
+	case "note":
+		repo.Note, err = tomlString(entry.Value)
+	case "remote":
+		repo.Remote, err = tomlString(entry.Value)
+	case "ignore":
+		repo.Ignore, err = tomlStrings(entry.Value)
+		for _, pattern := range repo.Ignore {
+			if err == nil {
+				_, err = compileGlob(pattern)
+			}
+		}
+	case "pathspec":
+		repo.Pathspec, err = tomlStrings(entry.Value)
+	case "ref":
+		repo.Ref, err = tomlString(entry.Value)
+	case "ignore_untracked":
+		repo.IgnoreUntracked, err = tomlBool(entry.Value)
+	default:
+		err = fmt.Errorf("unknown key")
+	}
+	return err
+}
+
+// applyTag reads a [tag.name] table
+func (config *Config) applyTag(entry tomlEntry) (err error) {
+	if !isTagName(entry.Table[1]) {
+		return fmt.Errorf("invalid tag %q, tags are single words", entry.Table[1])
+	}
+	tag, ok := config.Tags[entry.Table[1]]
+	if !ok {
+		tag = &TagConfig{}
+		config.Tags[entry.Table[1]] = tag
+	}
+
+	switch strings.Join(entry.Key, ".") {
+	case "report_behind":
+		var reportBehind bool
+		reportBehind, err = tomlBool(entry.Value)
+		tag.IgnoreBehind = !reportBehind
+	case "fetch":
+		tag.Fetch, err = tomlBool(entry.Value)
+	case "ref":
+		tag.Ref, err = tomlString(entry.Value)
+	default:
+		err = fmt.Errorf("unknown key")
+	}
+	return err
+}
+
+// isTagName is true for tags that can be given to --tag and refresh as is
+func isTagName(tag string) bool {
+	return tag != "" && !strings.ContainsAny(tag, " \t,\"'$")
+}
+
+func isArchived(path string) bool {
+	repo, ok := config.Repos[path]
+	return ok && repo.Archived
+}
+
+func getNote(path string) string {
+	if repo, ok := config.Repos[path]; ok {
+		return repo.Note
+	}
+	return ""
+}
+
+// setConfigValue writes a single key to the config file, editing it in place
+// so comments and the order of everything else are kept. A nil value removes
+// the key.
+func setConfigValue(table []string, key string, value interface{}) error {
+	if len(table) > 1 && table[0] == "repo" {
+		err := checkPlaintext("the config")
+		if err != nil {
+			return err
+		}
+	}
+	raw, err := ioutil.ReadFile(configFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []string
+	if len(raw) != 0 {
+		lines = strings.Split(strings.TrimRight(strings.Replace(string(raw), "\r\n", "\n", -1), "\n"), "\n")
+	}
+	newLine := ""
+	if value != nil {
+		newLine = tomlKey([]string{key}) + " = " + tomlEncode(value)
+	}
+
+	var current []string
+	tableEnd := -1
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "[") {
+			p := &tomlParser{src: strings.TrimLeft(line, "[")}
+			current, _ = p.key()
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.Join(current, "\x00") != strings.Join(table, "\x00") {
+			continue
+		}
+		tableEnd = i + 1
+		end := i
+		for open := tomlOpenBrackets(line); open > 0 && end+1 < len(lines); open = tomlOpenBrackets(strings.Join(lines[i:end+1], "\n")) {
+			end++
+		}
+		p := &tomlParser{src: line}
+		lineKey, err := p.key()
+		if err == nil && len(lineKey) == 1 && lineKey[0] == key {
+			replacement := []string{}
+			if value != nil {
+				replacement = append(replacement, newLine)
+			}
+			lines = append(lines[:i], append(replacement, lines[end+1:]...)...)
+			return writeConfigLines(lines)
+		}
+		i = end
+		tableEnd = end + 1
+	}
+	if value == nil {
+		return nil
+	}
+
+	if tableEnd == -1 {
+		// The table may exist without any keys yet
+		for i, line := range lines {
+			if strings.TrimSpace(line) == "["+tomlKey(table)+"]" {
+				tableEnd = i + 1
+			}
+		}
+	}
+	if tableEnd == -1 {
+		if len(lines) != 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+tomlKey(table)+"]", newLine)
+	} else {
+		lines = append(lines[:tableEnd], append([]string{newLine}, lines[tableEnd:]...)...)
+	}
+	return writeConfigLines(lines)
+}
+
+// writeConfigLines writes the config, private to the user when new since it
+// can hold the server token and webhook credentials
+func writeConfigLines(lines []string) error {
+	return writeFileAtomicMode(configFile, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+// tomlKey formats a dotted key, quoting the parts that aren't bare keys
+func tomlKey(key []string) string {
+	var parts []string
+	for _, part := range key {
+		bare := part != ""
+		for _, r := range part {
+			if !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				bare = false
+			}
+		}
+		if bare {
+			parts = append(parts, part)
+		} else {
+			parts = append(parts, tomlEncode(part))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func tomlEncode(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return tomlQuote(value)
+	case bool:
+		return strconv.FormatBool(value)
+	case int:
+		return strconv.Itoa(value)
+	case []string:
+		var items []string
+		for _, item := range value {
+			items = append(items, tomlQuote(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case []interface{}:
+		var items []string
+		for _, item := range value {
+			items = append(items, tomlEncode(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+// tomlQuote writes a basic string with only the escapes TOML has, where
+// strconv.Quote would also use Go's \x and \a
+func tomlQuote(value string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\u%04X`, r)
+		default:
+			// Invalid UTF-8 comes out as U+FFFD, which TOML accepts
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// RepoFile holds the overrides a project declares in its own .git-status.toml
+// so they travel with the repo across machines
+type RepoFile struct {
+	Ignore          []string
+	IgnoreUntracked bool
+}
+
+func loadRepoFile(repo string) (repoFile RepoFile) {
+	file := filepath.Join(repo, configName)
+	raw, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return repoFile
+	}
+	if err == nil {
+		var entries []tomlEntry
+		entries, err = parseToml(string(raw))
+		for _, entry := range entries {
+			switch entry.Name() {
+			case "ignore":
+				repoFile.Ignore, err = tomlStrings(entry.Value)
+			case "ignore_untracked":
+				repoFile.IgnoreUntracked, err = tomlBool(entry.Value)
+			default:
+				err = fmt.Errorf("unknown key")
+			}
+			if err != nil {
+				fmt.Printf("%s:%d: %s: %s\n", file, entry.Line, entry.Name(), err.Error())
+				return RepoFile{}
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("%s:%s\n", file, err.Error())
+		return RepoFile{}
+	}
+	return repoFile
+}
+
+// tomlEntry is a single key/value pair from a toml document along with the
+// table it was declared in. Only the subset of toml used by the config is
+// understood: tables, array tables, strings, integers, booleans and arrays.
+type tomlEntry struct {
+	Table []string
+	Index int
+	Key   []string
+	Value interface{}
+	Line  int
+}
+
+func (entry tomlEntry) Name() string {
+	return strings.Join(append(append([]string{}, entry.Table...), entry.Key...), ".")
+}
+
+func tomlStrings(value interface{}) ([]string, error) {
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array of strings")
+	}
+	var strs []string
+	for _, item := range array {
+		str, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected an array of strings")
+		}
+		strs = append(strs, str)
+	}
+	return strs, nil
+}
+
+func tomlString(value interface{}) (string, error) {
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string")
+	}
+	return str, nil
+}
+
+func tomlInt(value interface{}) (int, error) {
+	num, ok := value.(int64)
+	if !ok {
+		return 0, fmt.Errorf("expected an integer")
+	}
+	return int(num), nil
+}
+
+func tomlBool(value interface{}) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected true or false")
+	}
+	return b, nil
+}
+
+func tomlDuration(value interface{}) (time.Duration, error) {
+	str, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("expected a duration like \"10s\"")
+	}
+	duration, err := parseDuration(str)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", str)
+	}
+	return duration, nil
+}
+
+func parseToml(raw string) ([]tomlEntry, error) {
+	var entries []tomlEntry
+	var table []string
+	index := -1
+	arrayTables := map[string]int{}
+
+	lines := strings.Split(strings.Replace(raw, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNum := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			isArray := strings.HasPrefix(line, "[[")
+			closing := "]"
+			if isArray {
+				closing = "]]"
+			}
+			p := &tomlParser{src: line[len(closing):]}
+			name, err := p.key()
+			if err != nil {
+				return nil, fmt.Errorf("%d: %s", lineNum, err.Error())
+			}
+			p.space()
+			if !strings.HasPrefix(p.src, closing) {
+				return nil, fmt.Errorf("%d: expected %s", lineNum, closing)
+			}
+			p.src = p.src[len(closing):]
+			if err = p.end(); err != nil {
+				return nil, fmt.Errorf("%d: %s", lineNum, err.Error())
+			}
+			table = name
+			index = -1
+			if isArray {
+				joined := strings.Join(name, ".")
+				index = arrayTables[joined]
+				arrayTables[joined]++
+			}
+			continue
+		}
+
+		// Arrays may span several lines, keep reading until they are closed
+		for tomlOpenBrackets(line) > 0 && i+1 < len(lines) {
+			i++
+			line += "\n" + lines[i]
+		}
+
+		p := &tomlParser{src: line}
+		key, err := p.key()
+		if err != nil {
+			return nil, fmt.Errorf("%d: %s", lineNum, err.Error())
+		}
+		p.space()
+		if !strings.HasPrefix(p.src, "=") {
+			return nil, fmt.Errorf("%d: expected =", lineNum)
+		}
+		p.src = p.src[1:]
+		value, err := p.value()
+		if err == nil {
+			err = p.end()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%d: %s", lineNum, err.Error())
+		}
+		entries = append(entries, tomlEntry{Table: table, Index: index, Key: key, Value: value, Line: lineNum})
+	}
+	return entries, nil
+}
+
+// tomlOpenBrackets counts the array brackets left unclosed in the given lines
+func tomlOpenBrackets(lines string) int {
+	open := 0
+	var quote rune
+	escaped := false
+	comment := false
+	for _, r := range lines {
+		switch {
+		case comment:
+			comment = r != '\n'
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' && quote == '"' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			comment = true
+		case r == '[':
+			open++
+		case r == ']':
+			open--
+		}
+	}
+	return open
+}
+
+type tomlParser struct {
+	src string
+}
+
+func (p *tomlParser) space() {
+	for {
+		p.src = strings.TrimLeft(p.src, " \t\n")
+		if !strings.HasPrefix(p.src, "#") {
+			return
+		}
+		newline := strings.Index(p.src, "\n")
+		if newline == -1 {
+			p.src = ""
+			return
+		}
+		p.src = p.src[newline:]
+	}
+}
+
+func (p *tomlParser) end() error {
+	p.space()
+	if p.src != "" {
+		return fmt.Errorf("unexpected %q", p.src)
+	}
+	return nil
+}
+
+func (p *tomlParser) key() ([]string, error) {
+	var key []string
+	for {
+		p.space()
+		var part string
+		var err error
+		if strings.HasPrefix(p.src, "\"") || strings.HasPrefix(p.src, "'") {
+			part, err = p.str()
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			end := strings.IndexFunc(p.src, func(r rune) bool {
+				return !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+			})
+			if end == -1 {
+				end = len(p.src)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("expected a key")
+			}
+			part = p.src[:end]
+			p.src = p.src[end:]
+		}
+		key = append(key, part)
+		p.space()
+		if !strings.HasPrefix(p.src, ".") {
+			return key, nil
+		}
+		p.src = p.src[1:]
+	}
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	p.space()
+	switch {
+	case strings.HasPrefix(p.src, "\"") || strings.HasPrefix(p.src, "'"):
+		return p.str()
+	case strings.HasPrefix(p.src, "["):
+		p.src = p.src[1:]
+		array := []interface{}{}
+		for {
+			p.space()
+			if strings.HasPrefix(p.src, "]") {
+				p.src = p.src[1:]
+				return array, nil
+			}
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+			p.space()
+			if strings.HasPrefix(p.src, ",") {
+				p.src = p.src[1:]
+			} else if !strings.HasPrefix(p.src, "]") {
+				return nil, fmt.Errorf("expected , or ] in array")
+			}
+		}
+	case strings.HasPrefix(p.src, "true"):
+		p.src = p.src[4:]
+		return true, nil
+	case strings.HasPrefix(p.src, "false"):
+		p.src = p.src[5:]
+		return false, nil
+	}
+
+	end := strings.IndexAny(p.src, " \t\n,]#")
+	if end == -1 {
+		end = len(p.src)
+	}
+	num, err := strconv.ParseInt(strings.Replace(p.src[:end], "_", "", -1), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", p.src[:end])
+	}
+	p.src = p.src[end:]
+	return num, nil
+}
+
+func (p *tomlParser) str() (string, error) {
+	quote := p.src[0]
+	p.src = p.src[1:]
+	if quote == '\'' {
+		end := strings.IndexAny(p.src, "'\n")
+		if end == -1 || p.src[end] != '\'' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		str := p.src[:end]
+		p.src = p.src[end+1:]
+		return str, nil
+	}
+
+	var str []byte
+	for i := 0; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '"':
+			p.src = p.src[i+1:]
+			return string(str), nil
+		case '\n':
+			return "", fmt.Errorf("unterminated string")
+		case '\\':
+			i++
+			if i == len(p.src) {
+				return "", fmt.Errorf("unterminated string")
+			}
+			switch p.src[i] {
+			case 'n':
+				str = append(str, '\n')
+			case 't':
+				str = append(str, '\t')
+			case 'r':
+				str = append(str, '\r')
+			case '"', '\\':
+				str = append(str, p.src[i])
+			case 'u':
+				if i+4 >= len(p.src) {
+					return "", fmt.Errorf("invalid escape")
+				}
+				code, err := strconv.ParseUint(p.src[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", fmt.Errorf("invalid escape")
+				}
+				buf := make([]byte, utf8.UTFMax)
+				str = append(str, buf[:utf8.EncodeRune(buf, rune(code))]...)
+				i += 4
+			default:
+				return "", fmt.Errorf("invalid escape \\%c", p.src[i])
+			}
+		default:
+			str = append(str, p.src[i])
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetConfigValueKeepsMode(t *testing.T) {
+	useTempSettings(t)
+	if err := setConfigValue([]string{"server"}, "token", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(configFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("new config has mode %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	if err := os.Chmod(configFile, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := setConfigValue([]string{"telemetry"}, "enabled", true); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(configFile); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("rewritten config has mode %v, %v, want 0640", info.Mode().Perm(), err)
+	}
+	if matches, _ := filepath.Glob(configFile + ".tmp*"); len(matches) != 0 {
+		t.Errorf("left temporary files %v", matches)
+	}
+}
+
+func TestParseToml(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []tomlEntry
+		err  string
+	}{
+		{"empty", "# only a comment\n\n", nil, ""},
+		{"key", "[report]\ntheme = \"dark\" # trailing\n", []tomlEntry{
+			{Table: []string{"report"}, Index: -1, Key: []string{"theme"}, Value: "dark", Line: 2},
+		}, ""},
+		{"types", "a = true\nb = 1_000\nc = 'C:\\path'\n", []tomlEntry{
+			{Index: -1, Key: []string{"a"}, Value: true, Line: 1},
+			{Index: -1, Key: []string{"b"}, Value: int64(1000), Line: 2},
+			{Index: -1, Key: []string{"c"}, Value: `C:\path`, Line: 3},
+		}, ""},
+		{"escapes", `a = "tab\there \"quoted\" \u00e9\\"`, []tomlEntry{
+			{Index: -1, Key: []string{"a"}, Value: "tab\there \"quoted\" é\\", Line: 1},
+		}, ""},
+		{"quoted table", "[repo.\"/src/my app\"]\ntags = [\n  \"a\",\n  \"b\",\n]\n", []tomlEntry{
+			{Table: []string{"repo", "/src/my app"}, Index: -1, Key: []string{"tags"}, Value: []interface{}{"a", "b"}, Line: 2},
+		}, ""},
+		{"array tables", "[[repo]]\npath = \"/a\"\n[[repo]]\npath = \"/b\"\n", []tomlEntry{
+			{Table: []string{"repo"}, Index: 0, Key: []string{"path"}, Value: "/a", Line: 2},
+			{Table: []string{"repo"}, Index: 1, Key: []string{"path"}, Value: "/b", Line: 4},
+		}, ""},
+		{"no equals", "theme\n", nil, "1: expected ="},
+		{"bad value", "a = maybe\n", nil, "1: invalid value"},
+		{"bad escape", `a = "\x41"`, nil, "1: invalid escape"},
+		{"unterminated", "a = \"open\n", nil, "1: unterminated string"},
+		{"unclosed table", "[report\n", nil, "1: expected ]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseToml(test.raw)
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Errorf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, %v, want %+v", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		env   []string
+		check func(Config) bool
+		err   string
+	}{
+		{"missing file is the defaults", "", nil, func(c Config) bool {
+			return reflect.DeepEqual(c, newConfig())
+		}, ""},
+		{"settings", "[report]\ntheme = \"deuteranopia\"\nmax_branch_width = 30\n[remote]\ntimeout = \"5s\"\n", nil, func(c Config) bool {
+			return c.Report.Theme == "deuteranopia" && c.Report.MaxBranchWidth == 30 && c.Remote.Timeout == 5*time.Second
+		}, ""},
+		{"repo table", "[repo.\"/src/app\"]\ntags = [\"work\"]\nnote = \"on hold\"\n", nil, func(c Config) bool {
+			return c.Repos["/src/app"] != nil && reflect.DeepEqual(c.Repos["/src/app"].Tags, []string{"work"}) && getNoteFrom(c, "/src/app") == "on hold"
+		}, ""},
+		{"environment wins", "[report]\nmax_branch_width = 30\n", []string{"GIT_STATUS_REPORT_MAX_BRANCH_WIDTH=12", "GIT_STATUS_STATE_DIR=/tmp"}, func(c Config) bool {
+			return c.Report.MaxBranchWidth == 12
+		}, ""},
+		{"every error reported", "[report]\nmax_branch_width = \"wide\"\n[remote]\ntimeout = 5\n", nil, nil, "config.toml:2: report.max_branch_width"},
+		{"bad environment", "", []string{"GIT_STATUS_FETCH_TIMEOUT=soon"}, nil, "GIT_STATUS_FETCH_TIMEOUT: invalid duration"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := filepath.Join(dir, "config.toml")
+			if test.raw != "" {
+				if err := os.WriteFile(file, []byte(test.raw), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, variable := range os.Environ() {
+				if strings.HasPrefix(variable, "GIT_STATUS_") {
+					t.Setenv(strings.SplitN(variable, "=", 2)[0], "")
+					os.Unsetenv(strings.SplitN(variable, "=", 2)[0])
+				}
+			}
+			for _, variable := range test.env {
+				parts := strings.SplitN(variable, "=", 2)
+				t.Setenv(parts[0], parts[1])
+			}
+			got, err := readConfig(file)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v, want %q", err, test.err)
+				}
+				if test.name == "every error reported" && len(err.(ConfigErrors)) != 2 {
+					t.Errorf("got %d errors, want 2", len(err.(ConfigErrors)))
+				}
+				return
+			}
+			if err != nil || !test.check(got) {
+				t.Errorf("got %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func getNoteFrom(c Config, path string) string {
+	previous := config
+	defer func() { config = previous }()
+	config = c
+	return getNote(path)
+}
+
+func TestTomlQuote(t *testing.T) {
+	for _, value := range []string{"plain", `C:\Users\me`, "\"quoted\"", "line\nbreak\ttab\rreturn", "bell\a escape\x1b del\x7f", "é ✓", "bad \xff byte"} {
+		p := &tomlParser{src: tomlQuote(value)}
+		got, err := p.str()
+		want := strings.ToValidUTF8(value, "\uFFFD")
+		if err != nil || got != want || p.src != "" {
+			t.Errorf("%q written as %s read back as %q, %v", value, tomlQuote(value), got, err)
+		}
+	}
+}
+
+func TestSetConfigValueRoundTrips(t *testing.T) {
+	useTempSettings(t)
+	original := "# my settings\n[report]\ntheme = \"dark\" # keep me\n\n[repo.\"/src/app\"]\nnote = \"old\"\n"
+	if err := os.WriteFile(configFile, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		table []string
+		key   string
+		value interface{}
+	}{
+		{[]string{"report"}, "theme", "deuteranopia"},
+		{[]string{"report"}, "max_branch_width", 30},
+		{[]string{"repo", "/src/app"}, "note", "line\nbreak \"quoted\" \a"},
+		{[]string{"repo", "/src/my app"}, "tags", []string{"work", "c:\\dir"}},
+		{[]string{"telemetry"}, "enabled", false},
+	}
+	for _, test := range tests {
+		if err := setConfigValue(test.table, test.key, test.value); err != nil {
+			t.Fatalf("%s.%s: %v", strings.Join(test.table, "."), test.key, err)
+		}
+	}
+	if err := setConfigValue([]string{"report"}, "max_branch_width", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(raw), "# my settings\n") || strings.Contains(string(raw), "max_branch_width") {
+		t.Errorf("comments or removals not kept:\n%s", raw)
+	}
+	read, err := readConfig(configFile)
+	if err != nil {
+		t.Fatalf("written config doesn't read back: %v\n%s", err, raw)
+	}
+	if read.Report.Theme != "deuteranopia" || read.Report.MaxBranchWidth != newConfig().Report.MaxBranchWidth {
+		t.Errorf("got report %+v", read.Report)
+	}
+	if got := getNoteFrom(read, "/src/app"); got != "line\nbreak \"quoted\" \a" {
+		t.Errorf("got note %q", got)
+	}
+	if tags := read.Repos["/src/my app"].Tags; !reflect.DeepEqual(tags, []string{"work", "c:\\dir"}) {
+		t.Errorf("got tags %q", tags)
+	}
+	if read.Telemetry.Enabled {
+		t.Error("telemetry not disabled")
+	}
+}
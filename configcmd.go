@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configCommands are the subcommands of config
+var configCommands = []string{"check", "path", "get", "set"}
+
+// runConfigCommand handles config subcommands. It runs before the config is
+// loaded so a broken config can still be checked.
+func runConfigCommand(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		return
+	}
+	switch args[0] {
+	case "check":
+		checkConfig()
+	case "path":
+		fmt.Println(store)
+	case "get":
+		if len(args) != 2 {
+			printUsage()
+			return
+		}
+		getConfig(args[1])
+	case "set":
+		if len(args) < 3 {
+			printUsage()
+			return
+		}
+		setConfig(args[1], args[2:])
+	default:
+		fmt.Println("unknown config command:", args[0])
+		os.Exit(1)
+	}
+}
+
+// checkConfig validates the config and the registry without checking any
+// repos, listing every problem with its file and line
+func checkConfig() {
+	loaded, err := readConfig(configFile)
+	var problems []string
+	if errs, ok := err.(ConfigErrors); ok {
+		problems = errs
+	} else if err != nil {
+		problems = []string{err.Error()}
+	}
+	// The registry may use [vars] and store settings from what did load
+	config = loaded
+	problems = append(problems, checkRegistry()...)
+
+	if len(problems) != 0 {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		os.Exit(exitConfigError)
+	}
+	fmt.Println(configFile, "and", store, "are valid")
+}
+
+// checkRegistry finds entries in the store that can't be checked: relative
+// paths, variables set nowhere and duplicates
+func checkRegistry() []string {
+	raw, err := readStore()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []string{"could not read registered repos: " + err.Error()}
+	}
+	entries, _, err := parseStore(raw)
+	if err != nil {
+		return []string{fmt.Sprintf("%s:%s", store, err.Error())}
+	}
+	var problems []string
+	if errs, ok := applyStoreOptions().(ConfigErrors); ok {
+		problems = errs
+	}
+	seen := map[string]int{}
+	for _, stored := range entries {
+		entry := stored.Text
+		if entry == "" || strings.HasPrefix(entry, commentIndicator) {
+			continue
+		}
+		path := expandEntry(entry)
+		switch {
+		case strings.Contains(path, "$"):
+			problems = append(problems, fmt.Sprintf("%s:%d: %s: uses a variable that isn't set", store, stored.Line, entry))
+		case !filepath.IsAbs(path):
+			problems = append(problems, fmt.Sprintf("%s:%d: %s: not an absolute path", store, stored.Line, entry))
+		case seen[path] != 0:
+			problems = append(problems, fmt.Sprintf("%s:%d: %s: already registered on line %d", store, stored.Line, entry, seen[path]))
+		default:
+			seen[path] = stored.Line
+		}
+	}
+	return problems
+}
+
+// getConfig prints a key as it is set in the config file, strings bare and
+// arrays one item per line. Like git config it exits 1 when it isn't set.
+func getConfig(name string) {
+	key, err := parseConfigKey(name)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	raw, err := ioutil.ReadFile(configFile)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("could not read config:", err.Error())
+		os.Exit(1)
+	}
+	entries, err := parseToml(string(raw))
+	if err != nil {
+		fmt.Printf("%s:%s\n", configFile, err.Error())
+		os.Exit(exitConfigError)
+	}
+	var value interface{}
+	for _, entry := range entries {
+		if strings.Join(append(append([]string{}, entry.Table...), entry.Key...), "\x00") == strings.Join(key, "\x00") {
+			value = entry.Value
+		}
+	}
+	switch value := value.(type) {
+	case nil:
+		os.Exit(1)
+	case []interface{}:
+		for _, item := range value {
+			fmt.Println(item)
+		}
+	default:
+		fmt.Println(value)
+	}
+}
+
+// setConfig writes a key to the config file, keeping its comments. The value
+// is read as TOML where it parses as a number, boolean, array or quoted
+// string and as a plain string otherwise, several values making an array.
+// Keys and values the config wouldn't load with are refused.
+func setConfig(name string, args []string) {
+	key, err := parseConfigKey(name)
+	if err != nil || len(key) < 2 {
+		fmt.Println("expected a key like report.theme:", name)
+		os.Exit(1)
+	}
+	var value interface{}
+	if len(args) == 1 {
+		value = parseConfigValue(args[0])
+	} else {
+		value = args
+	}
+	loaded, err := readConfig(configFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(exitConfigError)
+	}
+	entry := tomlEntry{Table: key[:len(key)-1], Index: -1, Key: key[len(key)-1:], Value: tomlValue(value)}
+	err = loaded.apply(entry)
+	if err != nil {
+		fmt.Printf("%s: %s\n", name, err.Error())
+		os.Exit(exitConfigError)
+	}
+	err = setConfigValue(entry.Table, entry.Key[0], value)
+	if err != nil {
+		fmt.Println("error saving config:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func parseConfigKey(name string) ([]string, error) {
+	p := &tomlParser{src: name}
+	key, err := p.key()
+	if err == nil && strings.TrimSpace(p.src) != "" {
+		err = fmt.Errorf("invalid key %q", name)
+	}
+	return key, err
+}
+
+// parseConfigValue turns a value from the command line into what
+// setConfigValue writes
+func parseConfigValue(arg string) interface{} {
+	p := &tomlParser{src: arg}
+	parsed, err := p.value()
+	if err != nil || strings.TrimSpace(p.src) != "" {
+		return arg
+	}
+	switch parsed := parsed.(type) {
+	case int64:
+		return int(parsed)
+	case []interface{}:
+		strs, err := tomlStrings(parsed)
+		if err != nil {
+			return arg
+		}
+		return strs
+	}
+	return parsed
+}
+
+// tomlValue is a value as parseToml would have read it, for apply
+func tomlValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case int:
+		return int64(value)
+	case []string:
+		array := []interface{}{}
+		for _, item := range value {
+			array = append(array, item)
+		}
+		return array
+	}
+	return value
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// exitCrash is the exit code after a panic, the same as an unrecovered one
+const exitCrash = 2
+
+// reportPanic is deferred by main and by the goroutines doing real work. A
+// panic is written to a diagnostic bundle in the temp dir instead of only to
+// a terminal nobody is watching when run from cron.
+func reportPanic() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	stack := debug.Stack()
+	file, err := ioutil.TempFile("", "git-status-crash-*.txt")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "git-status crashed: %v\n%s", recovered, stack)
+		os.Exit(exitCrash)
+	}
+	fmt.Fprintf(file, "git-status v%s, %s %s/%s\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(file, "time: %s\n", clock().Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(file, "args: %s\n\n", redactPaths(strings.Join(os.Args[1:], " ")))
+	fmt.Fprintf(file, "%s\n", describeConfig())
+	fmt.Fprintf(file, "panic: %s\n\n%s", redactPaths(fmt.Sprint(recovered)), redactPaths(string(stack)))
+	file.Close()
+
+	fmt.Fprintf(os.Stderr, "git-status crashed: %v\n", recovered)
+	fmt.Fprintf(os.Stderr, "details are in %s, please attach it to a bug report\n", file.Name())
+	os.Exit(exitCrash)
+}
+
+// describeConfig summarizes the settings that change what runs, leaving out
+// tokens and anything naming a repo
+func describeConfig() string {
+	lines := []string{
+		fmt.Sprintf("registered: %d", len(registryPaths())),
+		fmt.Sprintf("store: %s", redactPaths(store)),
+		fmt.Sprintf("config: %s", redactPaths(configFile)),
+		fmt.Sprintf("repo tables: %d, tag tables: %d, outputs: %d", len(config.Repos), len(config.Tags), len(config.Outputs)),
+		fmt.Sprintf("checks: %+v", config.Checks),
+		fmt.Sprintf("remote: check %t, timeout %s", config.Remote.Check, config.Remote.Timeout),
+		fmt.Sprintf("fetch: all %t, timeout %s, ssh multiplex %t", fetchAll, config.Fetch.Timeout, config.Fetch.SSHMultiplex),
+		fmt.Sprintf("report: theme %s, locale %s, jobs %d", config.Report.Theme, config.Report.Locale, jobs),
+		fmt.Sprintf("encrypted store: %t, remote store: %t", len(config.Store.EncryptTo) != 0, isRemoteStore()),
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// redactPaths replaces registered repos and the home dir, which name
+// customers and projects, with placeholders
+func redactPaths(text string) string {
+	paths := registryPaths()
+	placeholders := map[string]string{}
+	for i, path := range paths {
+		placeholders[path] = fmt.Sprintf("<repo %d>", i+1)
+	}
+	// Longest first, so /src/app-api isn't redacted as /src/app
+	sort.Slice(paths, func(i, j int) bool { return len(paths[i]) > len(paths[j]) })
+	for _, path := range paths {
+		text = strings.Replace(text, path, placeholders[path], -1)
+	}
+	if home != "" && home != "/" {
+		text = strings.Replace(text, home, "~", -1)
+	}
+	return text
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+// readStore reads the registry, decrypting it when it was saved encrypted
+// with age or gpg. Detection goes by content, so an encrypted store keeps
+// loading even if the config that asked for it is gone.
+func readStore() ([]byte, error) {
+	var raw []byte
+	var err error
+	if isRemoteStore() {
+		raw, err = fetchStore()
+	} else {
+		raw, err = ioutil.ReadFile(store)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(raw, []byte("-----BEGIN AGE ENCRYPTED FILE-----")) || bytes.HasPrefix(raw, []byte("age-encryption.org/")):
+		args := []string{"--decrypt"}
+		for _, identity := range config.Store.Identities {
+			args = append(args, "--identity", identity)
+		}
+		return runFilter(raw, "age", args...)
+	case bytes.HasPrefix(raw, []byte("-----BEGIN PGP MESSAGE-----")):
+		return runFilter(raw, "gpg", "--quiet", "--batch", "--decrypt")
+	}
+	return raw, nil
+}
+
+// checkPlaintext refuses to write repo paths to what, a file outside the
+// store, while the store is encrypted. The paths would otherwise sit next to
+// it in the clear.
+func checkPlaintext(what string) error {
+	if len(config.Store.EncryptTo) == 0 {
+		return nil
+	}
+	return fmt.Errorf("store.encrypt_to is set, refusing to write repo paths to %s unencrypted", what)
+}
+
+// encryptStore encrypts the registry for the recipients in store.encrypt_to,
+// with gpg for key ids and emails and age for age1 public keys
+func encryptStore(raw []byte) ([]byte, error) {
+	recipients := config.Store.EncryptTo
+	if len(recipients) == 0 {
+		return raw, nil
+	}
+	if strings.HasPrefix(recipients[0], "age1") || strings.HasPrefix(recipients[0], "ssh-") {
+		args := []string{"--encrypt", "--armor"}
+		for _, recipient := range recipients {
+			args = append(args, "--recipient", recipient)
+		}
+		return runFilter(raw, "age", args...)
+	}
+	args := []string{"--quiet", "--batch", "--yes", "--encrypt", "--armor"}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+	return runFilter(raw, "gpg", args...)
+}
+
+func runFilter(input []byte, name string, arg ...string) ([]byte, error) {
+	cmd := exec.Command(name, arg...)
+	cmd.Env = repoEnv()
+	cmd.Stdin = bytes.NewReader(input)
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, (&cmdError{Err: err, Stderr: strings.TrimSpace(stderr.String())}).Error())
+	}
+	return out.Bytes(), nil
+}
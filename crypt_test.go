@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedStoreRefusesPlaintextFiles(t *testing.T) {
+	dir := useTempSettings(t)
+	config.Store.EncryptTo = []string{"age1example"}
+
+	if err := setConfigValue([]string{"repo", "/src/app"}, "note", "secret project"); err == nil {
+		t.Error("wrote a [repo] table to the config")
+	}
+	if err := setConfigValue([]string{"report"}, "theme", "deuteranopia"); err != nil {
+		t.Errorf("refused a setting without repo paths: %v", err)
+	}
+
+	output := OutputConfig{Format: "json", Path: filepath.Join(dir, "out.json"), Filter: "all"}
+	if err := writeOutput(output, []RepoStatus{{Path: "/src/app"}}); err == nil {
+		t.Error("wrote a file output")
+	}
+	writeSnapshot([]RepoStatus{{Path: "/src/app"}})
+
+	stateLock.Lock()
+	loadState()
+	state.Names["/src/app"] = CachedName{Name: "app"}
+	stateDirty = true
+	stateLock.Unlock()
+	saveState()
+
+	for _, file := range []string{output.Path, snapshotPath(), statePath()} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s was written", file)
+		}
+	}
+}
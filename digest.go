@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runDigest fetches every repo and reports only when the statuses differ
+// from the previous digest, so it can run from cron without spamming. The
+// report goes to stdout, or is piped into digest.command when configured.
+func runDigest() {
+	file := filepath.Join(stateDir, "digest.json")
+	err := checkPlaintext(file)
+	if err != nil {
+		fmt.Println("error saving digest:", err.Error())
+		os.Exit(1)
+	}
+	fetchAll = true
+	report := newReport(collectStatuses())
+	report.Registry = registryPaths()
+
+	var previous Report
+	raw, err := ioutil.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(raw, &previous)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("error reading previous digest:", err.Error())
+	}
+
+	changes := append(diffRegistry(previous.Registry, report.Registry), diffReports(previous, report)...)
+	if len(changes) != 0 {
+		var buf bytes.Buffer
+		printHeader(&buf, report)
+		if previous.Generated.IsZero() {
+			fmt.Fprintln(&buf, "first digest:")
+		} else {
+			fmt.Fprintln(&buf, "changed since", previous.Generated.Local().Format("2006-01-02 15:04")+":")
+		}
+		for _, change := range changes {
+			fmt.Fprintln(&buf, "  "+change)
+		}
+		if flagged := flaggedStatuses(report.Repos); len(flagged) != 0 {
+			fmt.Fprintln(&buf)
+			printStatuses(&buf, flagged, false)
+		}
+		err = emitDigest(buf.Bytes())
+		if err != nil {
+			fmt.Println("error sending digest:", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	err = writeJSONFile(file, report)
+	if err != nil {
+		fmt.Println("error saving digest:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func emitDigest(digest []byte) error {
+	if config.Digest.Command == "" {
+		_, err := os.Stdout.Write(digest)
+		return err
+	}
+	cmd := exec.Command("sh", "-c", config.Digest.Command)
+	cmd.Stdin = bytes.NewReader(digest)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// diffReports lists the repos whose status changed between two runs
+func diffReports(previous Report, current Report) []string {
+	before := map[string]RepoStatus{}
+	for _, repo := range previous.Repos {
+		before[repo.Path] = repo
+	}
+	var changes []string
+	for _, repo := range current.Repos {
+		old, existed := before[repo.Path]
+		now := summarizeStatus(repo)
+		switch {
+		case !existed && repo.ShouldReport:
+			changes = append(changes, repo.Name+" "+now)
+		case existed && summarizeStatus(old) != now:
+			changes = append(changes, repo.Name+" "+now+" (was "+summarizeStatus(old)+")")
+		}
+	}
+	return changes
+}
+
+// registryPaths lists the registered repos, archived ones included, so a
+// digest can tell when the registry was changed behind the user's back
+func registryPaths() []string {
+	var paths []string
+	for _, path := range registered {
+		if len(path) != 0 && !strings.HasPrefix(path, commentIndicator) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// diffRegistry lists the repos registered or dropped between two runs.
+// Digests from before the registry was recorded don't count as empty.
+func diffRegistry(previous []string, current []string) []string {
+	if previous == nil {
+		return nil
+	}
+	var changes []string
+	for _, path := range current {
+		if !contains(previous, path) {
+			changes = append(changes, "registered "+path)
+		}
+	}
+	for _, path := range previous {
+		if !contains(current, path) {
+			changes = append(changes, "no longer registered "+path)
+		}
+	}
+	return changes
+}
+
+// summarizeStatus describes a status in one line the way the table does
+func summarizeStatus(repo RepoStatus) string {
+	if !repo.ShouldReport {
+		return "clean"
+	}
+	var parts []string
+	if repo.RemoteBranchError {
+		parts = append(parts, "!ERROR!")
+	}
+	if repo.Detached != "" {
+		parts = append(parts, "detached")
+	}
+	if repo.Unpushed > 0 {
+		parts = append(parts, "↑"+strconv.Itoa(repo.Unpushed))
+	}
+	if repo.Unpulled > 0 {
+		parts = append(parts, "↓"+strconv.Itoa(repo.Unpulled))
+	}
+	if repo.PRReady {
+		parts = append(parts, "push me")
+	}
+	if repo.Deltas > 0 {
+		parts = append(parts, "∆"+strconv.Itoa(repo.Deltas))
+	}
+	if repo.ModeChanges > 0 {
+		parts = append(parts, "("+strconv.Itoa(repo.ModeChanges)+" mode only)")
+	}
+	if repo.LineEndings > 0 {
+		parts = append(parts, "("+strconv.Itoa(repo.LineEndings)+" line endings only)")
+	}
+	if repo.CaseRenames > 0 {
+		parts = append(parts, "("+strconv.Itoa(repo.CaseRenames)+" case renames)")
+	}
+	if repo.Stashes > 0 {
+		parts = append(parts, "⚑"+strconv.Itoa(repo.Stashes))
+	}
+	if repo.Pending {
+		parts = append(parts, "pending")
+	}
+	if repo.Unavailable {
+		parts = append(parts, "unavailable")
+	}
+	if repo.Missing != "" {
+		parts = append(parts, repo.Missing)
+	}
+	if repo.Empty {
+		parts = append(parts, "empty")
+	}
+	if repo.MissingRefs > 0 {
+		parts = append(parts, strconv.Itoa(repo.MissingRefs)+" refs missing")
+	}
+	if repo.UnsafeOwnership {
+		parts = append(parts, "unsafe ownership")
+	}
+	if repo.Permissions != "" {
+		parts = append(parts, repo.Permissions)
+	}
+	if hasStaleBranches(repo) {
+		parts = append(parts, fmt.Sprintf("⎇ %d/%d", repo.Branches, repo.UntrackedBranches))
+	}
+	if repo.AuthRequired {
+		parts = append(parts, "auth required")
+	} else if repo.RemoteUnreachable {
+		parts = append(parts, "unreachable")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var globCache = map[string]*regexp.Regexp{}
+
+// compileGlob turns a glob into a regexp. ** matches across directories,
+// * and ? stay within a single path element, and a leading ~/ is the home dir.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	if re, ok := globCache[pattern]; ok {
+		return re, nil
+	}
+	glob := pattern
+	if strings.HasPrefix(glob, "~/") {
+		glob = filepath.ToSlash(home) + glob[1:]
+	}
+
+	expr := "^"
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				expr += "(.*/)?"
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				expr += ".*"
+				i++
+			} else {
+				expr += "[^/]*"
+			}
+		case '?':
+			expr += "[^/]"
+		case '[':
+			end := strings.Index(glob[i:], "]")
+			if end == -1 {
+				return nil, fmt.Errorf("invalid glob %q: unterminated [", pattern)
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr += "[" + class + "]"
+			i += end
+		default:
+			expr += regexp.QuoteMeta(string(c))
+		}
+	}
+	expr += "$"
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %s", pattern, err.Error())
+	}
+	globCache[pattern] = re
+	return re, nil
+}
+
+// isExcluded checks dir against the discovery excludes. Patterns without a
+// slash match the folder name anywhere, like they would in a .gitignore.
+func isExcluded(dir string) bool {
+	slashed := filepath.ToSlash(dir)
+	for _, pattern := range config.Discovery.Exclude {
+		re, err := compileGlob(pattern)
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(pattern, "/") {
+			if re.MatchString(filepath.Base(dir)) {
+				return true
+			}
+		} else if re.MatchString(slashed) || re.MatchString(slashed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverRepos finds every repo beneath roots, honoring the configured
+// excludes and max depth. Submodules and nested clones are only reported
+// when skipping nested repos is off.
+func discoverRepos(roots []string) []string {
+	var found []string
+	for _, root := range roots {
+		rootDepth := strings.Count(filepath.Clean(root), string(filepath.Separator))
+		filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+			if err != nil {
+				if dir == root {
+					fmt.Println("error scanning path:", err.Error())
+				}
+				return nil
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			switch info.Name() {
+			case ".git", ".jj", ".svn":
+				return filepath.SkipDir
+			}
+			if isExcluded(dir) {
+				return filepath.SkipDir
+			}
+			depth := strings.Count(dir, string(filepath.Separator)) - rootDepth
+			if config.Discovery.MaxDepth > 0 && depth > config.Discovery.MaxDepth {
+				return filepath.SkipDir
+			}
+			if isRepo(dir) {
+				found = append(found, dir)
+				if config.Discovery.SkipNested {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		})
+	}
+	return found
+}
+
+// scanRepos registers the repos found beneath roots that aren't registered
+// yet, or only lists them with --dry-run
+func scanRepos(roots []string) {
+	var found []string
+	for _, path := range discoverRepos(roots) {
+		if !contains(registered, path) {
+			found = append(found, path)
+		}
+	}
+	if len(found) == 0 {
+		fmt.Println("no new repos found")
+		return
+	}
+	if dryRun {
+		for _, path := range found {
+			fmt.Println("would register", path)
+		}
+		return
+	}
+	registerPaths(found)
+	fmt.Printf("registered %d repos\n", len(found))
+}
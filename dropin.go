@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// invokedByGit is true when git ran us, from an alias or as an external
+// command. git sets GIT_EXEC_PATH for both.
+func invokedByGit() bool {
+	return os.Getenv("GIT_EXEC_PATH") != ""
+}
+
+// shouldDeferToGit is true for a bare run through git from inside a repo,
+// where the user most likely wanted that repo's git status. Any command or
+// flag still gets the multi-repo behavior, as does the alias install-alias
+// sets up.
+func shouldDeferToGit() bool {
+	if len(os.Args) != 1 || !invokedByGit() || os.Getenv("GIT_STATUS_ALIAS") != "" {
+		return false
+	}
+	inside, err := getCmdOutput(".", "git", "rev-parse", "--is-inside-work-tree")
+	return err == nil && inside == "true"
+}
+
+// deferToGit runs the real git status for the current repo in our place
+func deferToGit() {
+	cmd := exec.Command("git", "status")
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		fmt.Println("error running git status:", err.Error())
+		os.Exit(1)
+	}
+}
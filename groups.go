@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// groups are the tags given with --group. A run is limited to the repos
+// with any of them and shows each group under its own header.
+var groups []string
+
+func inGroups(path string) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	repo, ok := config.Repos[path]
+	if !ok {
+		return false
+	}
+	for _, group := range groups {
+		if contains(repo.Tags, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// addToGroups tags registered repos with the groups given to add, keeping
+// the tags they already have. The tags go in the repo's [[repo]] table in
+// the store, which takes over from those in the config.
+func addToGroups(targets []string, names []string) {
+	tagged := map[string][]string{}
+	for _, target := range targets {
+		if !contains(registered, target) {
+			continue
+		}
+		var tags []string
+		if repo, ok := config.Repos[target]; ok {
+			tags = append(tags, repo.Tags...)
+		}
+		changed := false
+		for _, name := range names {
+			if !contains(tags, name) {
+				tags = append(tags, name)
+				changed = true
+			}
+		}
+		if changed {
+			tagged[target] = tags
+		}
+	}
+	if len(tagged) == 0 {
+		return
+	}
+	updateStore(func(entries []string) []string {
+		for target, tags := range tagged {
+			setStoreOption(target, "tags", tags)
+		}
+		return entries
+	})
+}
+
+// printGroupedStatuses prints the table once per group, under the group's
+// name. A repo in several of the groups shows up under each.
+func printGroupedStatuses(w io.Writer, repos []RepoStatus, all bool) {
+	for i, group := range groups {
+		var members []RepoStatus
+		for _, repo := range repos {
+			if configRepo, ok := config.Repos[repo.Path]; ok && contains(configRepo.Tags, group) {
+				members = append(members, repo)
+			}
+		}
+		if i != 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, group)
+		if len(members) == 0 {
+			fmt.Fprintln(w, "  "+tr("no repos"))
+			continue
+		}
+		if len(flaggedStatuses(members)) == 0 && !all {
+			fmt.Fprintln(w, "  "+tr("all clean"))
+			continue
+		}
+		printStatuses(w, members, all)
+	}
+}
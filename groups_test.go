@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddToGroupsWritesStore(t *testing.T) {
+	useTempSettings(t)
+	repo := "/src/app"
+	original := "[repo.\"/src/app\"]\ntags = [\"old\"]\n"
+	if err := ioutil.WriteFile(configFile, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if config, err = readConfig(configFile); err != nil {
+		t.Fatal(err)
+	}
+	writeStore(t, repo, "/src/other")
+	loadRegistered()
+
+	addToGroups([]string{repo}, []string{"work", "old"})
+	if raw, _ := ioutil.ReadFile(configFile); string(raw) != original {
+		t.Errorf("config changed:\n%s", raw)
+	}
+	raw, err := ioutil.ReadFile(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "path = \"/src/app\"\ntags = [\"old\", \"work\"]\n") {
+		t.Errorf("tags not in the store:\n%s", raw)
+	}
+
+	registered, storeOptions = nil, map[string][]tomlEntry{}
+	if config, err = readConfig(configFile); err != nil {
+		t.Fatal(err)
+	}
+	loadRegistered()
+	if tags := config.Repos[repo].Tags; !reflect.DeepEqual(tags, []string{"old", "work"}) {
+		t.Errorf("got tags %q after reloading", tags)
+	}
+	groups = []string{"work"}
+	defer func() { groups = nil }()
+	if !inGroups(repo) || inGroups("/src/other") {
+		t.Error("group membership doesn't follow the store")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	xlanguage "golang.org/x/text/language"
+)
+
+// Locale holds how a language writes numbers, dates and ages
+type Locale struct {
+	Thousands string
+	Date      string
+	Days      string
+	Hours     string
+	Minutes   string
+}
+
+var locales = map[string]Locale{
+	"en": {Thousands: ",", Date: "Jan 2 15:04", Days: "d", Hours: "h", Minutes: "m"},
+	"de": {Thousands: ".", Date: "2.1. 15:04", Days: " Tg", Hours: " Std", Minutes: " Min"},
+}
+
+// catalogFiles are the message catalogs, one per language named after it,
+// like locales/de.json. Messages are keyed by their English text, which the
+// code already has, so there is no English catalog. A message missing from a
+// catalog is shown in English.
+//
+//go:embed locales/*.json
+var catalogFiles embed.FS
+
+var bundle = loadCatalogs()
+
+var language = "en"
+var localizer = i18n.NewLocalizer(bundle, language)
+
+func loadCatalogs() *i18n.Bundle {
+	bundle := i18n.NewBundle(xlanguage.English)
+	files, _ := fs.Glob(catalogFiles, "locales/*.json")
+	for _, file := range files {
+		_, err := bundle.LoadMessageFileFS(catalogFiles, file)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return bundle
+}
+
+// setLanguage picks the language from report.locale, or from the usual
+// locale variables, falling back to English for anything without a catalog
+func setLanguage() {
+	locale := config.Report.Locale
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale == "" {
+			locale = os.Getenv(name)
+		}
+	}
+	// de_DE.UTF-8 and de-AT alike are German
+	lang := ""
+	fields := strings.FieldsFunc(locale, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || r == '@'
+	})
+	if len(fields) != 0 {
+		lang = strings.ToLower(fields[0])
+	}
+	if _, ok := locales[lang]; ok {
+		language = lang
+	} else {
+		language = "en"
+	}
+	localizer = i18n.NewLocalizer(bundle, language)
+}
+
+// tr translates a message, formatting it with args like fmt.Sprintf
+func tr(message string, args ...interface{}) string {
+	translated, err := localizer.Localize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{ID: message, Other: message},
+	})
+	if translated == "" && err != nil {
+		translated = message
+	}
+	if len(args) == 0 {
+		return translated
+	}
+	return fmt.Sprintf(translated, args...)
+}
+
+// trn translates a message about count things in the form the language's
+// plural rules call for, like 1 ref but 2 refs. {{.Count}} in the message
+// is the count with its digits grouped. The English plural is the key.
+func trn(one string, other string, count int) string {
+	translated, err := localizer.Localize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{ID: other, One: one, Other: other},
+		PluralCount:    count,
+		TemplateData:   map[string]string{"Count": formatNumber(count)},
+	})
+	if translated == "" && err != nil {
+		return strings.Replace(other, "{{.Count}}", formatNumber(count), -1)
+	}
+	return translated
+}
+
+// formatNumber groups the digits of a count the way the language does
+func formatNumber(n int) string {
+	digits := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + formatNumber(-n)
+	}
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + locales[language].Thousands + digits[i:]
+	}
+	return digits
+}
+
+func formatDate(t time.Time) string {
+	return t.In(clock().Location()).Format(locales[language].Date)
+}
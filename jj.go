@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+)
+
+type jjBackend struct{}
+
+func (jjBackend) Detect(dir string) bool {
+	dotjj, err := os.Stat(path.Join(dir, ".jj"))
+	if err != nil || !dotjj.IsDir() {
+		return false
+	}
+	return true
+}
+
+// Status computes the status of a jj colocated repo. jj keeps the git HEAD
+// detached, so the upstream based git checks would always report an error.
+func (jjBackend) Status(repo string) (status RepoStatus) {
+	status.Name = getCachedRepoName(repo)
+	status.RemoteBranch = "jj"
+	if _, err := exec.LookPath("jj"); err != nil {
+		// Without jj only the working copy reported by git can be trusted
+		if config.Checks.Worktree {
+			status.Deltas = getDeltas(repo)
+		}
+		return status
+	}
+	if config.Checks.Worktree {
+		status.Deltas = getJjDeltas(repo)
+	}
+	if config.Checks.Remote {
+		status.Unpushed = getJjRevisionCount(repo, "remote_bookmarks()..@-")
+		status.Unpulled = getJjRevisionCount(repo, "::trunk() ~ ::@")
+	}
+
+	return status
+}
+
+func (jjBackend) Fetch(repo string) error {
+	if _, err := exec.LookPath("jj"); err != nil {
+		return gitBackend{}.Fetch(repo)
+	}
+	_, err := getNetworkCmdOutput(config.Fetch.Timeout, repo, "jj", "git", "fetch")
+	return err
+}
+
+func getJjDeltas(repo string) int {
+	raw, err := getCmdOutput(repo, "jj", "diff", "--summary", "-r", "@")
+	if err != nil {
+		fmt.Println("error getting jj deltas count:", err.Error())
+		return -1
+	}
+	return countLines(raw)
+}
+
+func getJjRevisionCount(repo string, revset string) int {
+	raw, err := getCmdOutput(repo, "jj", "log", "--no-graph", "-r", revset, "-T", `commit_id ++ "\n"`)
+	if err != nil {
+		fmt.Println("error getting jj revision count:", err.Error())
+		return -1
+	}
+	return countLines(raw)
+}
@@ -1,29 +1,76 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"os/exec"
 	"os/user"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
 )
 
 // RepoStatus x
 type RepoStatus struct {
-	Name              string
-	RemoteBranch      string
-	RemoteBranchError bool
-	Unpulled          int
-	Unpushed          int
-	Deltas            int
-	ShouldReport      bool
+	Path              string    `json:"path"`
+	Name              string    `json:"name"`
+	RemoteBranch      string    `json:"remote_branch"`
+	RemoteBranchError bool      `json:"remote_branch_error"`
+	PushBranch        string    `json:"push_branch,omitempty"`
+	Unpulled          int       `json:"unpulled"`
+	Unpushed          int       `json:"unpushed"`
+	Deltas            int       `json:"deltas"`
+	RemoteUnreachable bool      `json:"remote_unreachable"`
+	AuthRequired      bool      `json:"auth_required"`
+	UnsafeOwnership   bool      `json:"unsafe_ownership"`
+	Branches          int       `json:"branches"`
+	UntrackedBranches int       `json:"untracked_branches"`
+	LastActivity      time.Time `json:"last_activity,omitzero"`
+	Note              string    `json:"note,omitempty"`
+	Operation         string    `json:"operation,omitempty"`
+	DivergedSince     time.Time `json:"diverged_since,omitzero"`
+	Empty             bool      `json:"empty,omitempty"`
+	MissingRefs       int       `json:"missing_refs,omitempty"`
+	Pending           bool      `json:"pending,omitempty"`
+	PRReady           bool      `json:"pr_ready,omitempty"`
+	ModeChanges       int       `json:"mode_changes,omitempty"`
+	Release           string    `json:"release,omitempty"`
+	Acknowledged      bool      `json:"acknowledged,omitempty"`
+	SnoozedUntil      time.Time `json:"snoozed_until,omitzero"`
+	UntrackedSkipped  bool      `json:"untracked_skipped,omitempty"`
+	Sparse            bool      `json:"sparse,omitempty"`
+	Unavailable       bool      `json:"unavailable,omitempty"`
+	Missing           string    `json:"missing,omitempty"`
+	LineEndings       int       `json:"line_endings,omitempty"`
+	CaseRenames       int       `json:"case_renames,omitempty"`
+	Permissions       string    `json:"permissions,omitempty"`
+	Stashes           int       `json:"stashes,omitempty"`
+	Staged            int       `json:"staged,omitempty"`
+	Modified          int       `json:"modified,omitempty"`
+	Untracked         int       `json:"untracked,omitempty"`
+	Detached          string    `json:"detached,omitempty"`
+	ShouldReport      bool      `json:"should_report"`
+}
+
+// Backend x
+type Backend interface {
+	Detect(dir string) bool
+	Status(dir string) RepoStatus
+}
+
+// Fetcher is implemented by backends that can refresh their remote refs
+type Fetcher interface {
+	Fetch(dir string) error
 }
 
 // Action x
@@ -37,26 +84,115 @@ const (
 	ActionList
 	ActionHelp
 	ActionVersion
+	ActionFixSafeDirectory
+	ActionMerge
+	ActionDigest
+	ActionGcBranches
+	ActionArchive
+	ActionUnarchive
+	ActionNote
+	ActionWhy
+	ActionTidy
+	ActionBench
+	ActionInitShell
+	ActionPrompt
+	ActionRPC
+	ActionMatrix
+	ActionRefresh
+	ActionReleases
+	ActionAssertClean
+	ActionAck
+	ActionSnooze
+	ActionRun
+	ActionCompletionData
+	ActionPath
+	ActionVerify
+	ActionConfig
+	ActionScan
+	ActionTUI
+	ActionPlugin
+	ActionInstallAlias
 )
 
 const version string = "1.1"
 const storeName string = ".git-status"
+const configName string = ".git-status.toml"
 const commentIndicator string = "#"
 const permissions os.FileMode = 0644
 
+// jj colocated repos also contain a .git folder, so jj must be tried first
+var backends = []Backend{jjBackend{}, gitBackend{}, mirrorBackend{}, svnBackend{}}
+
 var registered []string
 var paths []string
+var operands []string
 var action Action
+var home string
 var store string
+var configFile string
+var stateDir string
 var showAll bool
+var recursive bool
+var skipNested bool
+var scanDepth int
+var checkRemote bool
+var hosted bool
+var schema bool
+var jsonOutput bool
+var selftest bool
+var noColor bool
+var fixedWidth bool
+var watchInterval time.Duration
+
+// clock is the time reports are made at, fixed by --mock-time so output can
+// be compared against golden files
+var clock = time.Now
+var noRemoteChecks bool
+var noWorktreeChecks bool
+var tag string
+var header bool
+var actions bool
+var themeName string
+var maxBranchWidth = -1
+var shortBranch bool
+var release bool
+var emitScriptFlag bool
+var title string
+var listen string
+var debugEndpoints bool
+var fetchAll bool
+var dryRun bool
+var sortBy string
+var ignoreCase bool
+var ignoreUntracked bool
+var idleFor time.Duration
+var olderThan = 30 * 24 * time.Hour
+var broken bool
+var benchRuns = 5
+var includeArchived bool
+var remoteTimeout time.Duration
+var fetchTimeout time.Duration
+var maxDuration time.Duration
+var jobs = runtime.NumCPU()
+var prReadyAfter time.Duration
 
 func init() {
+	parseArgs(os.Args[1:])
+	if action == ActionRun {
+		runProfile()
+	}
+}
+
+// parseArgs sets the action and flags from the command line
+func parseArgs(args []string) {
 	var err error
 
-	if len(os.Args) >= 2 {
-		switch strings.ToUpper(os.Args[1]) {
+	if len(args) >= 1 {
+		switch strings.ToUpper(args[0]) {
 		case "+":
 			fallthrough
+		case "ADD":
+			fallthrough
 		case "--ADD":
 			fallthrough
 		case "-ADD":
@@ -92,13 +228,6 @@ func init() {
 		case "-LIST":
 			action = ActionList
 
-		case "-A":
-			fallthrough
-		case "--ALL":
-			fallthrough
-		case "-ALL":
-			showAll = true
-
 		case "-H":
 			fallthrough
 		case "--HELP":
@@ -114,329 +243,2326 @@ func init() {
 			fallthrough
 		case "-VERSION":
 			action = ActionVersion
-		}
-	}
-	if action == ActionAdd || action == ActionDelete {
-		if len(os.Args) >= 3 {
-			for _, arg := range os.Args[2:] {
-				abs, err := filepath.Abs(arg)
-				if err != nil {
-					fmt.Println("error parsing path:", err.Error())
-					os.Exit(1)
-				}
-				paths = append(paths, abs)
-			}
-		} else {
-			action = ActionHelp
-		}
-	}
 
-	usr, err := user.Current()
-	if err != nil {
-		fmt.Println("error finding home dir:", err.Error())
-		os.Exit(1)
-	}
-	store = path.Join(usr.HomeDir, storeName)
-}
+		case "--FIX-SAFE-DIRECTORY":
+			fallthrough
+		case "-FIX-SAFE-DIRECTORY":
+			action = ActionFixSafeDirectory
 
-func main() {
-	_, err := exec.LookPath("git")
-	if err != nil {
-		fmt.Println("git could not be found:", err.Error())
-		os.Exit(1)
-	}
-	loadRegistered()
-	switch action {
-	case ActionAdd:
-		registerPaths(paths)
-	case ActionDelete:
-		removePaths(paths)
-	case ActionList:
-		listRegistered()
-	case ActionHelp:
-		printUsage()
-	case ActionVersion:
-		fmt.Println("git-status v" + version)
-	default:
-		getStatuses()
-	}
-}
+		case "MERGE":
+			fallthrough
+		case "--MERGE":
+			fallthrough
+		case "-MERGE":
+			action = ActionMerge
 
-func printUsage() {
-	usage := `git-status [-add|-delete paths...]|[-list|-a|-h]
-  -add     Add a folder to monitor
-  -delete  Remove a folder, stop monitoring
-  -list    List all monitored paths
-  -a       Show status on all registered paths
-  -h       Show this help
-  -v       Print version`
-	fmt.Println(usage)
-}
+		case "DIGEST":
+			fallthrough
+		case "--DIGEST":
+			fallthrough
+		case "-DIGEST":
+			action = ActionDigest
 
-func contains(array []string, target string) bool {
-	for _, str := range array {
-		if str == target {
-			return true
-		}
-	}
-	return false
-}
+		case "GC-BRANCHES":
+			fallthrough
+		case "--GC-BRANCHES":
+			fallthrough
+		case "-GC-BRANCHES":
+			action = ActionGcBranches
 
-func padRight(str string, length int) string {
-	for len(str) < length {
-		str += " "
-	}
-	return str
-}
+		case "ARCHIVE":
+			fallthrough
+		case "--ARCHIVE":
+			fallthrough
+		case "-ARCHIVE":
+			action = ActionArchive
 
-func loadRegistered() {
-	raw, err := ioutil.ReadFile(store)
-	if os.IsNotExist(err) {
-		return
-	}
-	if err != nil {
-		fmt.Println("could not read registered repos")
-		os.Exit(1)
-	}
-	lines := strings.Split(string(raw), "\n")
+		case "UNARCHIVE":
+			fallthrough
+		case "--UNARCHIVE":
+			fallthrough
+		case "-UNARCHIVE":
+			action = ActionUnarchive
 
-	for _, line := range lines {
-		path := strings.TrimSpace(line)
-		if !contains(registered, path) || path == "" || strings.HasPrefix(path, commentIndicator) {
-			registered = append(registered, path)
-		}
-	}
-	// Remove trailing empty lines if they exist
-	for len(registered) != 0 && registered[len(registered)-1] == "" {
-		registered = registered[:len(registered)-1]
-	}
-}
+		case "NOTE":
+			fallthrough
+		case "--NOTE":
+			fallthrough
+		case "-NOTE":
+			action = ActionNote
 
-func listRegistered() {
-	var output string
-	var count int
-	for _, dir := range registered {
-		if len(dir) != 0 && !strings.HasPrefix(dir, commentIndicator) {
-			count++
-			output += "  " + dir + "\n"
-		}
-	}
-	switch count {
-	case 0:
-		fmt.Println("No paths registered")
-	case 1:
-		fmt.Println("1 path registered:")
-	default:
-		fmt.Println(count, "paths registered:")
-	}
-	fmt.Println(output)
-}
+		case "WHY":
+			fallthrough
+		case "--WHY":
+			fallthrough
+		case "-WHY":
+			action = ActionWhy
 
-func removePaths(except []string) {
-	os.Remove(store)
-	f, err := os.OpenFile(store, os.O_RDWR|os.O_CREATE, permissions)
-	if err != nil {
-		fmt.Println("error saving paths:", err.Error())
-		fmt.Println("dumping lines:")
-		for _, path := range registered {
-			fmt.Println(path)
-		}
-	}
-	defer f.Close()
-	firstWrite := true
-	for _, path := range registered {
-		if !contains(except, path) {
-			if !firstWrite {
-				f.WriteString("\n")
-			}
-			f.WriteString(path)
-			firstWrite = false
-		}
-	}
-}
+		case "TIDY":
+			fallthrough
+		case "--TIDY":
+			fallthrough
+		case "-TIDY":
+			action = ActionTidy
 
-func commentPaths(except []string) {
-	os.Remove(store)
-	f, err := os.OpenFile(store, os.O_RDWR|os.O_CREATE, permissions)
-	if err != nil {
-		fmt.Println("error saving paths:", err.Error())
-		fmt.Println("dumping lines:")
-		for _, path := range registered {
-			fmt.Println(path)
-		}
-	}
-	defer f.Close()
-	for i, path := range registered {
-		if !contains(except, path) {
-			f.WriteString(path)
-		} else {
-			f.WriteString(commentIndicator + path)
-		}
-		if i+1 != len(registered) {
-			f.WriteString("\n")
-		}
-	}
-}
+		case "BENCH":
+			fallthrough
+		case "--BENCH":
+			fallthrough
+		case "-BENCH":
+			action = ActionBench
 
-func registerPaths(targets []string) {
-	f, err := os.OpenFile(store, os.O_RDWR|os.O_APPEND|os.O_CREATE, permissions)
-	if err != nil {
-		fmt.Println("error registering path:", err.Error())
-	}
-	defer f.Close()
-	for _, target := range targets {
-		if contains(registered, target) {
-			fmt.Println(target, "is already registered")
-			continue
-		}
+		case "INIT-SHELL":
+			fallthrough
+		case "--INIT-SHELL":
+			fallthrough
+		case "-INIT-SHELL":
+			action = ActionInitShell
 
-		if !isRepo(target) {
-			fmt.Println(target, "does not appear to be a git repo")
-			continue
-		}
+		case "PROMPT":
+			fallthrough
+		case "--PROMPT":
+			fallthrough
+		case "-PROMPT":
+			action = ActionPrompt
 
-		f.WriteString("\n" + target)
-	}
-}
+		case "RPC":
+			fallthrough
+		case "--RPC":
+			fallthrough
+		case "-RPC":
+			action = ActionRPC
 
-func isRepo(dir string) bool {
-	dotgitpath := path.Join(dir, ".git")
-	dotgit, err := os.Stat(dotgitpath)
-	if err != nil || !dotgit.IsDir() {
-		return false
-	}
-	return true
-}
+		case "MATRIX":
+			fallthrough
+		case "--MATRIX":
+			fallthrough
+		case "-MATRIX":
+			action = ActionMatrix
 
-func getStatuses() {
-	repos := make([]RepoStatus, len(registered))
-	nameWidth := 0
-	branchWidth := 0
-	for i, path := range registered {
-		if len(path) == 0 || strings.HasPrefix(path, commentIndicator) {
-			continue
-		}
-		if !isRepo(path) {
-			fmt.Println(path, "no longer appears to be a git repo, commenting it out")
-			commentPaths([]string{path})
-			continue
-		}
-		repo := getStatus(path)
-		if (repo.ShouldReport || showAll) && len(repo.Name) > nameWidth {
-			nameWidth = len(repo.Name)
-		}
-		if (repo.ShouldReport || showAll) && len(repo.RemoteBranch) > branchWidth {
-			branchWidth = len(repo.RemoteBranch)
-		}
-		repos[i] = repo
-	}
-	for _, repo := range repos {
-		if repo.ShouldReport {
-			cyan := color.New(color.FgCyan).PrintfFunc()
-			yellow := color.New(color.FgYellow).PrintfFunc()
-			red := color.New(color.FgRed).PrintfFunc()
-			fmt.Printf("%s (", padRight(repo.Name, nameWidth))
-			if repo.RemoteBranchError {
-				red("%s", padRight("!ERROR!", branchWidth))
-			} else {
-				fmt.Printf("%s", padRight(repo.RemoteBranch, branchWidth))
-			}
-			fmt.Printf(") ")
-			if repo.Unpushed > 0 {
-				cyan("↑%d ", repo.Unpushed)
-			}
-			if repo.Unpulled > 0 {
-				cyan("↓%d ", repo.Unpulled)
-			}
-			if repo.Deltas > 0 {
-				yellow("∆%d", repo.Deltas)
+		case "REFRESH":
+			fallthrough
+		case "--REFRESH":
+			fallthrough
+		case "-REFRESH":
+			action = ActionRefresh
+
+		case "RELEASES":
+			fallthrough
+		case "--RELEASES":
+			fallthrough
+		case "-RELEASES":
+			action = ActionReleases
+
+		case "ASSERT-CLEAN":
+			fallthrough
+		case "--ASSERT-CLEAN":
+			fallthrough
+		case "-ASSERT-CLEAN":
+			action = ActionAssertClean
+
+		case "ACK":
+			fallthrough
+		case "--ACK":
+			fallthrough
+		case "-ACK":
+			action = ActionAck
+
+		case "CONFIG":
+			action = ActionConfig
+
+		case "--CONFIG":
+			fallthrough
+		case "-CONFIG":
+			// Otherwise it is the flag naming the config file
+			if len(args) == 1 || contains(configCommands, args[1]) {
+				action = ActionConfig
 			}
-			fmt.Println()
-		} else if showAll {
-			fmt.Printf("%-"+strconv.Itoa(nameWidth)+"s (%-"+strconv.Itoa(branchWidth)+"s) ", repo.Name, repo.RemoteBranch)
-			color.Green("✔\n")
-		}
-	}
-}
 
-func getStatus(repo string) (status RepoStatus) {
-	var err error
-	status.Name = getRepoName(repo)
-	status.RemoteBranch, err = getRemote(repo)
-	status.RemoteBranchError = err != nil
-	status.Unpulled = getUnpulled(repo, status.RemoteBranch)
-	status.Unpushed = getUnpushed(repo, status.RemoteBranch)
-	status.Deltas = getDeltas(repo)
+		case "SCAN":
+			fallthrough
+		case "--SCAN":
+			fallthrough
+		case "-SCAN":
+			action = ActionScan
 
-	status.ShouldReport = status.Unpulled > 0 || status.Unpushed > 0 || status.Deltas > 0 || status.RemoteBranchError
+		case "TUI":
+			fallthrough
+		case "--TUI":
+			fallthrough
+		case "-TUI":
+			action = ActionTUI
 
-	return status
-}
+		case "INSTALL-ALIAS":
+			fallthrough
+		case "--INSTALL-ALIAS":
+			fallthrough
+		case "-INSTALL-ALIAS":
+			action = ActionInstallAlias
 
-func getRepoName(repo string) string {
-	remote, err := getCmdOutput(repo, "git", "config", "--get", "remote.origin.url")
-	if err != nil {
-		fmt.Println("error getting repo name:", err.Error())
-		return ""
-	}
-	slash := strings.LastIndex(remote, "/")
-	if slash != -1 {
-		remote = remote[slash+1:]
-	}
-	remote = strings.TrimSuffix(remote, ".git")
-	return remote
-}
+		case "SNOOZE":
+			fallthrough
+		case "--SNOOZE":
+			fallthrough
+		case "-SNOOZE":
+			action = ActionSnooze
 
-func getRemote(repo string) (string, error) {
-	raw, err := getCmdOutput(repo, "git", "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
-	if err != nil {
-		return "", err
-	}
-	return raw, nil
-}
+		case "RUN":
+			fallthrough
+		case "--RUN":
+			fallthrough
+		case "-RUN":
+			action = ActionRun
 
-func getUnpulled(repo string, remote string) (unpulled int) {
-	raw, err := getCmdOutput(repo, "git", "rev-list", "--count", "HEAD.."+remote)
-	if err != nil {
-		fmt.Println("error getting unpulled count:", err.Error())
-		return -1
-	}
-	unpulled, err = strconv.Atoi(raw)
-	return unpulled
-}
+		case "COMPLETION-DATA":
+			fallthrough
+		case "--COMPLETION-DATA":
+			fallthrough
+		case "-COMPLETION-DATA":
+			action = ActionCompletionData
 
-func getUnpushed(repo string, remote string) (unpushed int) {
-	raw, err := getCmdOutput(repo, "git", "rev-list", "--count", remote+"..HEAD")
-	if err != nil {
-		fmt.Println("error getting unpushed count:", err.Error())
-		return -1
-	}
-	unpushed, err = strconv.Atoi(raw)
-	return unpushed
-}
+		case "PATH":
+			fallthrough
+		case "--PATH":
+			fallthrough
+		case "-PATH":
+			action = ActionPath
 
-func getDeltas(repo string) int {
-	raw, err := getCmdOutput(repo, "git", "status", "--porcelain")
-	if err != nil {
-		fmt.Println("error getting deltas count:", err.Error())
-		return -1
-	}
-	lines := strings.Split(raw, "\n")
-	if len(lines) == 1 && lines[0] == "" {
-		return 0
-	}
-	return len(lines)
-}
+		case "VERIFY":
+			fallthrough
+		case "--VERIFY":
+			fallthrough
+		case "-VERIFY":
+			action = ActionVerify
 
-func getCmdOutput(workingDir string, name string, arg ...string) (string, error) {
-	cmd := exec.Command(name, arg...)
-	cmd.Dir = workingDir
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
-		return "", err
+		default:
+			if plugin = findPlugin(args[0]); plugin != "" {
+				action = ActionPlugin
+			}
+		}
+		if action != ActionNone {
+			args = args[1:]
+		}
 	}
-	raw := strings.TrimSpace(out.String())
-	return raw, nil
+
+	// Flags may follow the action in any order, anything else is positional
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(flagName(args[i])) {
+		case "-A":
+			fallthrough
+		case "--ALL":
+			fallthrough
+		case "-ALL":
+			showAll = true
+
+		case "--RECURSIVE":
+			fallthrough
+		case "-RECURSIVE":
+			recursive = true
+
+		case "--DEPTH":
+			fallthrough
+		case "-DEPTH":
+			scanDepth, err = strconv.Atoi(flagValue(args, &i))
+			if err != nil || scanDepth < 1 {
+				fmt.Println("invalid depth:", args[i])
+				os.Exit(1)
+			}
+
+		case "--SKIP-NESTED":
+			fallthrough
+		case "-SKIP-NESTED":
+			skipNested = true
+
+		case "--TITLE":
+			fallthrough
+		case "-TITLE":
+			title = flagValue(args, &i)
+
+		case "--HEADER":
+			fallthrough
+		case "-HEADER":
+			header = true
+
+		case "--EMIT-SCRIPT":
+			fallthrough
+		case "-EMIT-SCRIPT":
+			emitScriptFlag = true
+
+		case "--SHORT-BRANCH":
+			fallthrough
+		case "-SHORT-BRANCH":
+			shortBranch = true
+
+		case "--RELEASE":
+			fallthrough
+		case "-RELEASE":
+			release = true
+
+		case "--MAX-BRANCH-WIDTH":
+			fallthrough
+		case "-MAX-BRANCH-WIDTH":
+			maxBranchWidth, err = strconv.Atoi(flagValue(args, &i))
+			if err != nil || maxBranchWidth < 0 {
+				fmt.Println("invalid width:", args[i])
+				os.Exit(1)
+			}
+
+		case "--THEME":
+			fallthrough
+		case "-THEME":
+			themeName = flagValue(args, &i)
+			if _, ok := themes[themeName]; !ok {
+				fmt.Println("unknown theme:", themeName+", expected one of", strings.Join(themeNames(), ", "))
+				os.Exit(1)
+			}
+
+		case "--ACTIONS":
+			fallthrough
+		case "-ACTIONS":
+			actions = true
+
+		case "--DRY-RUN":
+			fallthrough
+		case "-DRY-RUN":
+			fallthrough
+		case "-N":
+			dryRun = true
+
+		case "--INCLUDE-ARCHIVED":
+			fallthrough
+		case "-INCLUDE-ARCHIVED":
+			includeArchived = true
+
+		case "--SORT":
+			fallthrough
+		case "-SORT":
+			sortBy = strings.ToLower(flagValue(args, &i))
+			if sortBy != "activity" && sortBy != "name" {
+				fmt.Println("invalid sort, expected activity or name:", args[i])
+				os.Exit(1)
+			}
+
+		case "--IGNORE-UNTRACKED":
+			fallthrough
+		case "-IGNORE-UNTRACKED":
+			ignoreUntracked = true
+
+		case "--IGNORE-CASE":
+			fallthrough
+		case "-IGNORE-CASE":
+			fallthrough
+		case "-I":
+			ignoreCase = true
+
+		case "--RUNS":
+			fallthrough
+		case "-RUNS":
+			benchRuns, err = strconv.Atoi(flagValue(args, &i))
+			if err != nil || benchRuns < 1 {
+				fmt.Println("invalid number of runs:", args[i])
+				os.Exit(1)
+			}
+
+		case "--BROKEN":
+			fallthrough
+		case "-BROKEN":
+			broken = true
+
+		case "--OLDER-THAN":
+			fallthrough
+		case "-OLDER-THAN":
+			olderThan, err = parseDuration(flagValue(args, &i))
+			if err != nil || olderThan < 0 {
+				fmt.Println("invalid duration:", args[i])
+				os.Exit(1)
+			}
+
+		case "--IDLE-FOR":
+			fallthrough
+		case "-IDLE-FOR":
+			idleFor, err = parseDuration(flagValue(args, &i))
+			if err != nil || idleFor <= 0 {
+				fmt.Println("invalid idle duration:", args[i])
+				os.Exit(1)
+			}
+
+		case "--PR-READY-AFTER":
+			fallthrough
+		case "-PR-READY-AFTER":
+			prReadyAfter, err = parseDuration(flagValue(args, &i))
+			if err != nil || prReadyAfter <= 0 {
+				fmt.Println("invalid pr ready age:", args[i])
+				os.Exit(1)
+			}
+
+		case "--STORE":
+			fallthrough
+		case "-STORE":
+			store = flagValue(args, &i)
+
+		case "--CONFIG":
+			fallthrough
+		case "-CONFIG":
+			configFile = flagValue(args, &i)
+
+		case "--STATE-DIR":
+			fallthrough
+		case "-STATE-DIR":
+			stateDir = flagValue(args, &i)
+
+		case "--DEBUG-ENDPOINTS":
+			fallthrough
+		case "-DEBUG-ENDPOINTS":
+			debugEndpoints = true
+
+		case "--LISTEN":
+			fallthrough
+		case "-LISTEN":
+			listen = flagValue(args, &i)
+
+		case "--CHECK-REMOTE":
+			fallthrough
+		case "-CHECK-REMOTE":
+			checkRemote = true
+
+		case "--TAG":
+			fallthrough
+		case "-TAG":
+			tag = flagValue(args, &i)
+
+		case "--GROUP":
+			fallthrough
+		case "-GROUP":
+			for _, name := range strings.Split(flagValue(args, &i), ",") {
+				if !isTagName(name) {
+					fmt.Println("invalid group, groups are single words:", name)
+					os.Exit(1)
+				}
+				if !contains(groups, name) {
+					groups = append(groups, name)
+				}
+			}
+
+		case "--SELFTEST":
+			// Left out of the usage, it is for working on git-status itself
+			selftest = true
+
+		case "--WATCH":
+			fallthrough
+		case "-WATCH":
+			// The interval is optional
+			watchInterval = 10 * time.Second
+			if i+1 < len(args) {
+				if interval, err := parseDuration(args[i+1]); err == nil {
+					if interval <= 0 {
+						fmt.Println("invalid watch interval:", args[i+1])
+						os.Exit(1)
+					}
+					watchInterval = interval
+					i++
+				}
+			}
+
+		case "--NO-COLOR":
+			fallthrough
+		case "-NO-COLOR":
+			noColor = true
+
+		case "--FIXED-WIDTH":
+			fallthrough
+		case "-FIXED-WIDTH":
+			fixedWidth = true
+
+		case "--MOCK-TIME":
+			fallthrough
+		case "-MOCK-TIME":
+			mocked, err := time.Parse(time.RFC3339, flagValue(args, &i))
+			if err != nil {
+				fmt.Println("invalid mock time, expected one like 2024-01-02T15:04:05Z:", args[i])
+				os.Exit(1)
+			}
+			clock = func() time.Time { return mocked }
+
+		case "--JSON":
+			fallthrough
+		case "-JSON":
+			jsonOutput = true
+
+		case "--SCHEMA":
+			fallthrough
+		case "-SCHEMA":
+			schema = true
+
+		case "--HOSTED":
+			fallthrough
+		case "-HOSTED":
+			hosted = true
+
+		case "--NO-REMOTE-CHECKS":
+			fallthrough
+		case "-NO-REMOTE-CHECKS":
+			noRemoteChecks = true
+
+		case "--NO-WORKTREE-CHECKS":
+			fallthrough
+		case "-NO-WORKTREE-CHECKS":
+			noWorktreeChecks = true
+
+		case "--FETCH":
+			fallthrough
+		case "-FETCH":
+			fetchAll = true
+
+		case "--FETCH-TIMEOUT":
+			fallthrough
+		case "-FETCH-TIMEOUT":
+			fetchTimeout, err = parseDuration(flagValue(args, &i))
+			if err != nil || fetchTimeout <= 0 {
+				fmt.Println("invalid fetch timeout:", args[i])
+				os.Exit(1)
+			}
+
+		case "--REMOTE-TIMEOUT":
+			fallthrough
+		case "-REMOTE-TIMEOUT":
+			remoteTimeout, err = parseDuration(flagValue(args, &i))
+			if err != nil || remoteTimeout <= 0 {
+				fmt.Println("invalid remote timeout:", args[i])
+				os.Exit(1)
+			}
+
+		case "--JOBS":
+			fallthrough
+		case "-JOBS":
+			fallthrough
+		case "-J":
+			jobs, err = strconv.Atoi(flagValue(args, &i))
+			if err != nil || jobs < 1 {
+				fmt.Println("invalid number of jobs:", args[i])
+				os.Exit(1)
+			}
+
+		case "--TELEMETRY":
+			fallthrough
+		case "-TELEMETRY":
+			telemetrySetting = strings.ToLower(flagValue(args, &i))
+			if telemetrySetting != "on" && telemetrySetting != "off" {
+				fmt.Println("expected --telemetry on or off:", args[i])
+				os.Exit(1)
+			}
+
+		case "--MAX-DURATION":
+			fallthrough
+		case "-MAX-DURATION":
+			maxDuration, err = parseDuration(flagValue(args, &i))
+			if err != nil || maxDuration <= 0 {
+				fmt.Println("invalid max duration:", args[i])
+				os.Exit(1)
+			}
+
+		case "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+
+	if action == ActionAdd || action == ActionDelete || action == ActionArchive || action == ActionUnarchive || action == ActionScan {
+		if len(positional) == 0 && (action == ActionAdd || action == ActionScan) {
+			positional = []string{"."}
+		}
+		if len(positional) != 0 {
+			for _, arg := range positional {
+				abs, err := filepath.Abs(arg)
+				if err != nil {
+					fmt.Println("error parsing path:", err.Error())
+					os.Exit(1)
+				}
+				if action == ActionAdd && !recursive {
+					abs = findRepoRoot(abs)
+				}
+				paths = append(paths, abs)
+			}
+		} else {
+			action = ActionHelp
+		}
+	}
+	if action == ActionNote {
+		// The first operand is the repo, the rest is the note itself
+		if len(positional) == 0 {
+			action = ActionHelp
+		} else {
+			abs, err := filepath.Abs(positional[0])
+			if err != nil {
+				fmt.Println("error parsing path:", err.Error())
+				os.Exit(1)
+			}
+			paths = []string{abs}
+			positional = positional[1:]
+		}
+	}
+	operands = positional
+
+	resolvePaths()
+}
+
+// resolvePaths fills in the store, config and state locations not given with
+// flags or the environment. The user is only looked up when one of them has
+// to come from their home, so explicit paths work in containers and CI jobs
+// where the user may not exist.
+func resolvePaths() {
+	if store == "" {
+		store = os.Getenv("GIT_STATUS_STORE")
+	}
+	if configFile == "" {
+		configFile = os.Getenv("GIT_STATUS_CONFIG")
+	}
+	if stateDir == "" {
+		stateDir = os.Getenv("GIT_STATUS_STATE_DIR")
+	}
+	if stateDir == "" && os.Getenv("XDG_STATE_HOME") != "" {
+		stateDir = path.Join(os.Getenv("XDG_STATE_HOME"), "git-status")
+	}
+
+	home = os.Getenv("HOME")
+	if store == "" || configFile == "" || stateDir == "" {
+		usr, err := getInvokingUser()
+		if err != nil {
+			fmt.Println("error finding home dir:", err.Error())
+			os.Exit(1)
+		}
+		home = usr.HomeDir
+	}
+	if store == "" {
+		store = defaultStore()
+	}
+	if configFile == "" {
+		configFile = path.Join(home, configName)
+	}
+	if stateDir == "" {
+		stateDir = path.Join(home, ".local", "state", "git-status")
+	}
+	if strings.HasPrefix(store, "http://") {
+		// The list decides which repos are run, so it isn't fetched in
+		// the clear
+		fmt.Println("error: remote registries must use https:", store)
+		os.Exit(1)
+	}
+	store = expandHome(store)
+	configFile = expandHome(configFile)
+	stateDir = expandHome(stateDir)
+}
+
+// defaultStore is $XDG_CONFIG_HOME/git-status/repos, unless there already is
+// a ~/.git-status from before the store moved there
+func defaultStore() string {
+	legacy := path.Join(home, storeName)
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = path.Join(home, ".config")
+	}
+	return path.Join(configHome, "git-status", "repos")
+}
+
+// getInvokingUser finds whose registry to use. Under sudo that is the user
+// who ran sudo rather than root, whose registry is normally empty.
+func getInvokingUser() (*user.User, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	sudoUser := os.Getenv("SUDO_USER")
+	if usr.Uid != "0" || sudoUser == "" || sudoUser == "root" {
+		return usr, nil
+	}
+	usr, err = user.Lookup(sudoUser)
+	if err != nil {
+		return nil, fmt.Errorf("running under sudo but %s could not be looked up: %s", sudoUser, err.Error())
+	}
+	return usr, nil
+}
+
+// chownToInvoker hands files created under sudo back to the user who ran
+// it, so their registry doesn't end up owned by root
+func chownToInvoker(path string) {
+	if os.Getuid() != 0 || os.Getenv("SUDO_USER") == "" {
+		return
+	}
+	uid, err := strconv.Atoi(os.Getenv("SUDO_UID"))
+	if err != nil {
+		return
+	}
+	gid, err := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if err != nil {
+		return
+	}
+	os.Lchown(path, uid, gid)
+}
+
+// applyFlags lets command line flags override the config
+func applyFlags() {
+	if skipNested {
+		config.Discovery.SkipNested = true
+	}
+	if scanDepth > 0 {
+		config.Discovery.MaxDepth = scanDepth
+	}
+	if checkRemote {
+		config.Remote.Check = true
+	}
+	if title != "" {
+		config.Report.Title = title
+	}
+	if header {
+		config.Report.Header = true
+	}
+	if actions {
+		config.Report.Actions = true
+	}
+	if shortBranch {
+		config.Report.ShortBranch = true
+	}
+	if release {
+		config.Report.Release = true
+	}
+	if maxBranchWidth >= 0 {
+		config.Report.MaxBranchWidth = maxBranchWidth
+	}
+	if prReadyAfter > 0 {
+		config.Report.PRReadyAfter = prReadyAfter
+	}
+	if themeName != "" {
+		config.Report.Theme = themeName
+	}
+	theme = themes[config.Report.Theme]
+	setLanguage()
+	if remoteTimeout > 0 {
+		config.Remote.Timeout = remoteTimeout
+	}
+	if fetchTimeout > 0 {
+		config.Fetch.Timeout = fetchTimeout
+	}
+	if noRemoteChecks {
+		config.Checks.Remote = false
+	}
+	if noWorktreeChecks {
+		config.Checks.Worktree = false
+	}
+	if ignoreUntracked {
+		config.Report.IgnoreUntracked = true
+	}
+	if noColor {
+		color.NoColor = true
+	}
+}
+
+func main() {
+	defer reportPanic()
+	if schema {
+		printSchema()
+		return
+	}
+	_, err := exec.LookPath("git")
+	if err != nil {
+		fmt.Println("git could not be found:", err.Error())
+		os.Exit(1)
+	}
+	if selftest {
+		runSelftest()
+		return
+	}
+	if shouldDeferToGit() {
+		deferToGit()
+		return
+	}
+	if action == ActionConfig {
+		runConfigCommand(operands)
+		return
+	}
+	loadConfig()
+	applyFlags()
+	if telemetrySetting != "" {
+		setTelemetry(telemetrySetting)
+		return
+	}
+	loadRegistered()
+	switch action {
+	case ActionAdd:
+		if recursive {
+			paths = discoverRepos(paths)
+		}
+		registerPaths(paths)
+		addToGroups(paths, groups)
+	case ActionScan:
+		scanRepos(paths)
+	case ActionTUI:
+		runTUI()
+	case ActionPlugin:
+		runPlugin(operands)
+	case ActionInstallAlias:
+		installAlias(operands)
+	case ActionDelete:
+		removePaths(paths)
+	case ActionList:
+		listRegistered()
+	case ActionHelp:
+		printUsage()
+	case ActionVersion:
+		fmt.Println("git-status v" + version)
+	case ActionFixSafeDirectory:
+		fixSafeDirectories()
+	case ActionMerge:
+		mergeReports(operands, listen)
+	case ActionDigest:
+		runDigest()
+	case ActionGcBranches:
+		gcBranches()
+	case ActionArchive:
+		archivePaths(paths, true)
+	case ActionUnarchive:
+		archivePaths(paths, false)
+	case ActionNote:
+		setNote(paths[0], strings.Join(operands, " "))
+	case ActionInitShell:
+		initShell(strings.Join(operands, ""))
+	case ActionPrompt:
+		printPrompt()
+	case ActionRPC:
+		runRPC()
+	case ActionMatrix:
+		printMatrix(operands)
+	case ActionBench:
+		runBench(benchRuns)
+	case ActionTidy:
+		tidyStore()
+	case ActionWhy:
+		explainRepos(operands)
+	case ActionRefresh:
+		refreshRepos(operands)
+	case ActionReleases:
+		listReleases(hosted)
+	case ActionAssertClean:
+		assertClean(tag)
+	case ActionAck:
+		ackRepos(operands)
+	case ActionSnooze:
+		snoozeRepo(operands)
+	case ActionCompletionData:
+		printCompletionData()
+	case ActionPath:
+		printPath(operands)
+	case ActionVerify:
+		verifyDeployments(tag)
+	default:
+		if shouldRunWizard() {
+			runWizard()
+		}
+		if watchInterval > 0 {
+			watchStatuses(watchInterval)
+		}
+		start := time.Now()
+		repos := getStatuses()
+		recordTelemetry(len(repos), time.Since(start))
+	}
+}
+
+func printUsage() {
+	usage := `git-status [flags]|[-add [--recursive]|-delete paths...]|[-list|-h|-v]
+  -add     Add a folder to monitor, defaults to the repo in the current dir
+             --recursive    Add every repo found beneath the given folders
+             --group name   Add them to a group, the same as tagging them
+             --skip-nested  Don't look for repos inside other repos
+  scan [paths...] [--depth n] [--dry-run]
+           Register every repo beneath the given folders, the current one
+           by default, that isn't already. --dry-run lists them instead
+  -delete  Remove a folder, stop monitoring
+  -list [--broken]
+           List all monitored paths, or those commented out and why
+  -h       Show this help
+  -v       Print version
+  -fix-safe-directory  Offer to trust repos git refuses over ownership
+  digest   Fetch and report only when something changed since the last
+           digest, repos registered or dropped included, meant for
+           scheduled runs
+  archive paths...
+           Keep repos registered but leave them out of runs, see unarchive
+  tui      Browse every repo full screen, filter them by name and open
+           one to see its changed files and unpushed commits
+  note path [text...]
+           Attach a note to a repo, shown in -list and its status line.
+           Without text the note is removed
+  matrix names...
+           Show every local branch against its upstream and push target
+  run profile [flags...]
+           Run with the flags of a profile from the [profiles] table,
+           which may start with a command. Flags given here come last
+  ack names...
+           Leave repos out of reports until their status changes
+  snooze name 3d
+           Leave a repo out of reports for a while, 0 to wake it up
+  why names...
+           Explain why repos are flagged and how to resolve it
+  refresh names|tags...
+           Check only these repos and update the snapshot and outputs
+           from the last run with them. merge --listen does the same for
+           the repos of its machine on POST /refresh {"repos": [names]}
+  assert-clean [--tag name]
+           Exit non-zero, listing why, when any repo or any with the tag
+           is dirty, ahead or behind, to gate builds on pristine checkouts
+  config check
+           Validate the config and registry without checking any repos,
+           exiting with 3 when something is wrong, as any run does for a
+           bad config
+  config path
+           Print where the registry in use is
+  config get key
+           Print a key from the config, exiting 1 when it isn't set
+  config set key values...
+           Set a key in the config, like config set report.theme
+           deuteranopia. Several values make an array
+  verify [--tag name]
+           Exit non-zero when a deployment checkout drifted: HEAD isn't at
+           the ref set in its [repo] or [tag] table, or files changed
+  releases [--older-than 30d] [--hosted]
+           List repos whose default branch has commits past a tag older
+           than the given age. --hosted also compares the tag with the
+           latest GitHub release, using GITHUB_TOKEN when set
+  tidy [--older-than 30d] [--dry-run]
+           Sort and deduplicate the registry and drop commented out
+           entries that are older than the given age or no longer exist
+  bench [--runs 5]
+           Collect statuses repeatedly and report latency percentiles per
+           repo and per command
+  init-shell [bash|zsh|fish]
+           Print an alias, a gcd function, completion and a prompt
+           segment to eval from your shell's startup file
+  install-alias [name] [--dry-run]
+           Add a git alias, git repos by default, that runs git-status
+           without shadowing git status. --dry-run prints the git config
+           command instead
+  path name
+           Print where a repo lives. init-shell adds gcd name to cd there
+  completion-data
+           Print name, path and tags of each repo, tab separated, for
+           pickers like fzf
+  prompt   Print the number of flagged repos in the last snapshot
+  rpc      Serve JSON-RPC on stdin and stdout for editor plugins, with
+           status, list, subscribe and unsubscribe methods
+  gc-branches [--dry-run]
+           Delete local branches already merged into the default branch,
+           asking before touching each repo
+  merge [--listen :8080] reports...
+           Combine JSON reports from several machines into one view, with
+           --listen reports can also be POSTed by other machines' outputs.
+           /healthz and /readyz answer health checks, and
+           --debug-endpoints adds pprof and expvar under /debug/. Set
+           server.token, or server.tls_cert and server.client_ca, to
+           require credentials
+  name [args...]
+           Any other command runs git-status-name from PATH with the JSON
+           report of every repo on stdin, checked with the flags given.
+           Other arguments, and all of them after --, are passed to it
+
+Run bare by git, from an alias like st = !git-status, inside a repo,
+git-status runs git status for that repo instead. Any command or flag
+still covers every registered repo.
+
+flags
+  -a                   Show status on all registered paths
+  --group work,oss     Check only the repos in these groups, each listed
+                       under its name. Groups are tags
+  --title "text"       Label the report
+  --header             Label the report with the host and time
+  --actions            Suggest what to do about each flagged repo
+  --short-branch       Leave out the remote when it is origin
+  --release            Show how far each repo is past its latest tag,
+                       like v1.4.0+12
+  --max-branch-width n Shorten longer branches in the middle, 0 for no
+                       limit. JSON output always has them in full
+  --pr-ready-after 24h Mark branches that are ahead, clean and untouched
+                       for this long as "push me", done but never pushed
+  --theme name         Colors to use: default, or the colorblind friendly
+                       deuteranopia and protanopia
+  --emit-script        Print a shell script that pulls and pushes the
+                       flagged repos, to review and run
+  --fetch              Fetch every repo before counting what is behind,
+                       --jobs at a time
+  --fetch-timeout 30s  Give up on a fetch after this long, a minute by
+                       default
+  --check-remote       Verify each origin is reachable
+  --remote-timeout 5s  Give up on a remote after this long
+  --jobs n, -j n       Check this many repos at once, the number of CPUs
+                       by default
+  --max-duration 200ms Show what was collected by then and mark the rest
+                       as pending, for prompts and other integrations
+  --no-remote-checks   Skip comparing with upstreams, fetching and the
+                       remote check, for a quick look at local changes
+  --no-worktree-checks Skip counting uncommitted changes
+  --include-archived   Include archived repos
+  --watch [30s]        Refresh the table every 10s or the interval given,
+                       highlighting the repos whose status changed
+  --telemetry on|off   Record, or stop recording, the number of repos, run
+                       time and flag names of each run in telemetry.jsonl
+                       in the state dir, to attach to performance issues.
+                       Off unless turned on, nothing is ever sent
+  --no-color           Never color the output, even on a terminal
+  --fixed-width        Pad names to 24 columns and branches to
+                       report.max_branch_width, whatever the repos
+  --mock-time 2024-01-02T15:04:05Z
+                       Report as if run at this time, with --no-color and
+                       --fixed-width for reproducible output in tests
+  --json               Print every repo's status as a JSON array instead
+                       of the table, for jq and other tools
+  --schema             Print the JSON Schema of the json output
+  --store path         Registry to use instead of
+                       $XDG_CONFIG_HOME/git-status/repos, or ~/.git-status
+                       where that exists from older versions, or an
+                       https URL to a read-only list kept by a team.
+                       It is TOML, a [[repo]] table per repo with its
+                       path and optionally alias, remote, branch,
+                       ignore_untracked or any other [repo] key. A store
+                       with a path per line is migrated once
+  --config path        Config to use instead of ~/.git-status.toml
+  --state-dir path     Where snapshots and history are kept
+                       These can also be set with GIT_STATUS_STORE,
+                       GIT_STATUS_CONFIG and GIT_STATUS_STATE_DIR, and any
+                       config key with GIT_STATUS_<SECTION>_<KEY>, like
+                       GIT_STATUS_REPORT_THEME=protanopia
+  --sort activity      Order repos by their last activity, most recent first
+  --sort name          Order repos by name, with numbers in natural order
+  --ignore-case, -i    Ignore case when sorting by name or tidying
+  --ignore-untracked   Don't flag repos for untracked files, they are
+                       still counted on rows shown, with -a for clean ones
+  --idle-for 90d       List only repos untouched for at least this long`
+	fmt.Println(usage)
+}
+
+// parseDuration extends time.ParseDuration with days and weeks, like 90d
+func parseDuration(str string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(str, suffix) {
+			count, err := strconv.ParseFloat(strings.TrimSuffix(str, suffix), 64)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(count * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(str)
+}
+
+// flagName strips the value from a --flag=value argument
+func flagName(arg string) string {
+	if !strings.HasPrefix(arg, "-") {
+		return arg
+	}
+	return strings.SplitN(arg, "=", 2)[0]
+}
+
+// flagValue returns the value of the flag at args[*i], taken either from
+// after an = or from the next argument, which is then skipped
+func flagValue(args []string, i *int) string {
+	if split := strings.SplitN(args[*i], "=", 2); len(split) == 2 {
+		return split[1]
+	}
+	if *i+1 >= len(args) {
+		fmt.Println("missing value for", args[*i])
+		os.Exit(1)
+	}
+	*i++
+	return args[*i]
+}
+
+// expandHome replaces a leading ~/ with the user's home dir
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(home, path[2:])
+	}
+	return path
+}
+
+func contains(array []string, target string) bool {
+	for _, str := range array {
+		if str == target {
+			return true
+		}
+	}
+	return false
+}
+
+func padRight(str string, length int) string {
+	for utf8.RuneCountInString(str) < length {
+		str += " "
+	}
+	return str
+}
+
+// fixedNameWidth is the name column with --fixed-width
+const fixedNameWidth = 24
+
+// displayBranch is the upstream as shown in the table, without the common
+// origin/ prefix when --short-branch is on and shortened to fit
+func displayBranch(repo RepoStatus) string {
+	if repo.Detached != "" {
+		return "detached @ " + repo.Detached
+	}
+	branch := repo.RemoteBranch
+	if config.Report.ShortBranch {
+		branch = strings.TrimPrefix(branch, "origin/")
+	}
+	branch = truncateMiddle(branch, config.Report.MaxBranchWidth)
+	if repo.PushBranch != "" {
+		branch += " → " + truncateMiddle(repo.PushBranch, config.Report.MaxBranchWidth)
+	}
+	return branch
+}
+
+// truncateMiddle shortens str to width runes by replacing its middle with an
+// ellipsis, keeping both the remote and the end of the branch name readable
+func truncateMiddle(str string, width int) string {
+	runes := []rune(str)
+	if width <= 0 || len(runes) <= width {
+		return str
+	}
+	if width == 1 {
+		return "…"
+	}
+	head := (width - 1) / 2
+	tail := width - 1 - head
+	return string(runes[:head]) + "…" + string(runes[len(runes)-tail:])
+}
+
+func countLines(raw string) int {
+	if raw == "" {
+		return 0
+	}
+	return len(strings.Split(raw, "\n"))
+}
+
+func loadRegistered() {
+	raw, err := readStore()
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		fmt.Println("could not read registered repos:", err.Error())
+		os.Exit(1)
+	}
+	entries, legacy, err := parseStore(raw)
+	if err != nil {
+		fmt.Printf("%s:%s\n", store, err.Error())
+		os.Exit(exitConfigError)
+	}
+	legacyStore = legacy
+	err = applyStoreOptions()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(exitConfigError)
+	}
+	registered = registeredPaths(registered, entries)
+}
+
+// registeredPaths adds the store's entries to paths, skipping repos that
+// are already there
+func registeredPaths(paths []string, entries []storeEntry) []string {
+	for _, entry := range entries {
+		path := expandEntry(entry.Text)
+		if !contains(paths, path) || path == "" || strings.HasPrefix(path, commentIndicator) {
+			paths = append(paths, path)
+		}
+	}
+	// Remove trailing empty lines if they exist
+	for len(paths) != 0 && paths[len(paths)-1] == "" {
+		paths = paths[:len(paths)-1]
+	}
+	return paths
+}
+
+func listRegistered() {
+	if broken {
+		listBroken()
+		return
+	}
+	var output string
+	var count int
+	for _, dir := range registered {
+		if len(dir) != 0 && !strings.HasPrefix(dir, commentIndicator) {
+			count++
+			output += "  " + dir
+			if isArchived(dir) {
+				output += " (" + tr("archived") + ")"
+			}
+			if until := getSnooze(dir); !until.IsZero() {
+				output += " (" + tr("snoozed until %s", formatDate(until)) + ")"
+			}
+			if note := getNote(dir); note != "" {
+				output += "  # " + note
+			}
+			output += "\n"
+		}
+	}
+	switch count {
+	case 0:
+		fmt.Println(tr("No paths registered"))
+	default:
+		fmt.Println(trn("{{.Count}} path registered:", "{{.Count}} paths registered:", count))
+	}
+	fmt.Println(output)
+}
+
+// listBroken shows the entries that were commented out and why
+func listBroken() {
+	var output string
+	var count int
+	for _, entry := range registered {
+		if !strings.HasPrefix(entry, commentIndicator) {
+			continue
+		}
+		if isFreeComment(entry) {
+			continue
+		}
+		date, reason, path := parseComment(entry)
+		count++
+		output += "  " + path
+		if reason != "" {
+			output += "  " + reason
+		}
+		if !date.IsZero() {
+			output += " since " + date.Format("2006-01-02")
+		}
+		output += "\n"
+	}
+	switch count {
+	case 0:
+		fmt.Println("No broken paths")
+	case 1:
+		fmt.Println("1 broken path:")
+	default:
+		fmt.Println(count, "broken paths:")
+	}
+	fmt.Println(output)
+}
+
+func removePaths(except []string) {
+	updateStore(func(entries []string) []string {
+		var kept []string
+		for _, path := range entries {
+			if !contains(except, path) {
+				kept = append(kept, path)
+			}
+		}
+		return kept
+	})
+}
+
+// commentPaths comments out entries, recording when and why so that
+// -list --broken can explain where they went
+func commentPaths(except []string, reason string) {
+	updateStore(func(entries []string) []string {
+		for i, path := range entries {
+			if contains(except, path) {
+				entries[i] = fmt.Sprintf("%s %s %s: %s", commentIndicator, time.Now().Format("2006-01-02"), reason, storedEntry(path))
+			}
+		}
+		return entries
+	})
+}
+
+// archivePaths keeps repos in the registry for the record while leaving
+// them out of runs unless --include-archived is given
+func archivePaths(targets []string, archived bool) {
+	for _, target := range targets {
+		if !contains(registered, target) {
+			fmt.Println(target, "is not registered")
+			continue
+		}
+		var value interface{}
+		if archived {
+			value = true
+		}
+		err := setConfigValue([]string{"repo", target}, "archived", value)
+		if err != nil {
+			fmt.Println("error saving config:", err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+// setNote attaches a note to a repo, an empty note removes it
+func setNote(target string, note string) {
+	if !contains(registered, target) {
+		fmt.Println(target, "is not registered")
+		os.Exit(1)
+	}
+	var value interface{}
+	if note != "" {
+		value = note
+	}
+	err := setConfigValue([]string{"repo", target}, "note", value)
+	if err != nil {
+		fmt.Println("error saving config:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func registerPaths(targets []string) {
+	updateStore(func(entries []string) []string {
+		for _, target := range targets {
+			if contains(entries, target) {
+				fmt.Println(target, "is already registered")
+				continue
+			}
+
+			if !isRepo(target) {
+				fmt.Println(target, "does not appear to be a repo")
+				continue
+			}
+
+			contractEntry(target)
+			entries = append(entries, target)
+		}
+		return entries
+	})
+}
+
+func getBackend(dir string) Backend {
+	for _, backend := range backends {
+		if backend.Detect(dir) {
+			return backend
+		}
+	}
+	return nil
+}
+
+func isRepo(dir string) bool {
+	return getBackend(dir) != nil
+}
+
+// findRepoRoot walks up from dir to the repo containing it, so paths inside
+// a repo register the repo itself. dir is returned as is when not in a repo.
+func findRepoRoot(dir string) string {
+	for parent := dir; ; parent = filepath.Dir(parent) {
+		if isRepo(parent) {
+			return parent
+		}
+		if parent == filepath.Dir(parent) {
+			return dir
+		}
+	}
+}
+
+// getStatuses collects, prints and saves the statuses, returning them for
+// --watch
+func getStatuses() []RepoStatus {
+	repos := collectStatuses()
+	if idleFor > 0 {
+		repos = idleStatuses(repos, idleFor)
+		showAll = true
+	}
+	switch sortBy {
+	case "activity":
+		sortByActivity(repos)
+	case "name":
+		sortByName(repos)
+	}
+	if emitScriptFlag {
+		emitScript(os.Stdout, repos)
+		return repos
+	}
+	if jsonOutput {
+		err := printJSON(os.Stdout, repos)
+		if err != nil {
+			fmt.Println("error writing json:", err.Error())
+		}
+	}
+	writeOutputs(repos)
+	if config.Snapshot.Enabled {
+		writeSnapshot(repos)
+	}
+	return repos
+}
+
+// classifyPath checks a registered path. A path that is gone has no status,
+// only the reason to comment it out for.
+func classifyPath(path string) (status RepoStatus, gone string) {
+	switch {
+	case isUnavailable(path):
+		status = RepoStatus{Path: path, Name: filepath.Base(path), Unavailable: true, ShouldReport: true}
+	case !isRepo(path):
+		gone = "not a repo"
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			gone = "missing"
+		}
+		if isRemoteStore() {
+			// A remote registry can't be rewritten, so the repo is shown,
+			// likely not cloned here yet
+			status = RepoStatus{Path: path, Name: filepath.Base(path), Missing: gone, ShouldReport: true}
+			gone = ""
+		}
+	default:
+		status = getStatus(path)
+	}
+	return status, gone
+}
+
+// collectStatuses checks the registered repos with --jobs workers and
+// returns their statuses in registration order
+func collectStatuses() []RepoStatus {
+	var candidates []string
+	for _, path := range registered {
+		if len(path) == 0 || strings.HasPrefix(path, commentIndicator) {
+			continue
+		}
+		if isArchived(path) && !includeArchived {
+			continue
+		}
+		if strings.Contains(path, "$") {
+			fmt.Println(path, "uses a variable that isn't set, skipping it")
+			continue
+		}
+		if !inGroups(path) {
+			continue
+		}
+		candidates = append(candidates, path)
+	}
+
+	var lock sync.Mutex
+	statuses := make([]RepoStatus, len(candidates))
+	finished := make([]bool, len(candidates))
+	gone := make([]string, len(candidates))
+	queue := make(chan int)
+	done := make(chan struct{})
+	var workers sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		workers.Add(1)
+		go func() {
+			defer reportPanic()
+			defer workers.Done()
+			for i := range queue {
+				status, reason := classifyPath(candidates[i])
+				lock.Lock()
+				statuses[i] = status
+				gone[i] = reason
+				finished[i] = true
+				lock.Unlock()
+			}
+		}()
+	}
+	go func() {
+		for i := range candidates {
+			queue <- i
+		}
+		close(queue)
+		workers.Wait()
+		close(done)
+	}()
+
+	var deadline <-chan time.Time
+	if maxDuration > 0 {
+		deadline = time.After(maxDuration)
+	}
+	select {
+	case <-done:
+	case <-deadline:
+		// Whatever is still being checked is left running and reported as
+		// pending, so a prompt never waits on one slow repo
+		lock.Lock()
+		defer lock.Unlock()
+		var collected []RepoStatus
+		for i, path := range candidates {
+			switch {
+			case !finished[i]:
+				collected = append(collected, RepoStatus{Path: path, Name: filepath.Base(path), Pending: true, ShouldReport: true})
+			case gone[i] == "":
+				collected = append(collected, statuses[i])
+			}
+		}
+		return collected
+	}
+
+	var repos []RepoStatus
+	for i, path := range candidates {
+		if gone[i] == "" {
+			repos = append(repos, statuses[i])
+			continue
+		}
+		// The registry is only rewritten once the workers are done with it
+		fmt.Println(path, "no longer appears to be a repo, commenting it out")
+		commentPaths([]string{path}, gone[i])
+	}
+	saveState()
+	return repos
+}
+
+// printStatuses writes the status table to w. Colors are only used when
+// writing to the terminal.
+func printStatuses(w io.Writer, repos []RepoStatus, all bool) {
+	paint := func(attributes ...color.Attribute) func(string, ...interface{}) {
+		if w == os.Stdout {
+			return color.New(attributes...).PrintfFunc()
+		}
+		return func(format string, a ...interface{}) {
+			fmt.Fprintf(w, format, a...)
+		}
+	}
+	sync := paint(theme.Sync...)
+	changes := paint(theme.Changes...)
+	alert := paint(theme.Error...)
+	clean := paint(theme.Clean...)
+
+	nameWidth := 0
+	branchWidth := 0
+	for _, repo := range repos {
+		if (repo.ShouldReport || all) && utf8.RuneCountInString(repo.Name) > nameWidth {
+			nameWidth = utf8.RuneCountInString(repo.Name)
+		}
+		branch := displayBranch(repo)
+		if (repo.ShouldReport || all) && utf8.RuneCountInString(branch) > branchWidth {
+			branchWidth = utf8.RuneCountInString(branch)
+		}
+	}
+	if fixedWidth {
+		// The same columns whatever repos are in the run
+		nameWidth = fixedNameWidth
+		branchWidth = config.Report.MaxBranchWidth
+	}
+	for _, repo := range repos {
+		branch := displayBranch(repo)
+		if repo.ShouldReport {
+			if hasChanged(repo) {
+				paint(color.ReverseVideo)("%s", padRight(repo.Name, nameWidth))
+				fmt.Fprintf(w, " (")
+			} else {
+				fmt.Fprintf(w, "%s (", padRight(repo.Name, nameWidth))
+			}
+			if repo.RemoteBranchError {
+				alert("%s", padRight("!ERROR!", branchWidth))
+			} else {
+				fmt.Fprintf(w, "%s", padRight(branch, branchWidth))
+			}
+			fmt.Fprintf(w, ") ")
+			if repo.Unpushed > 0 {
+				sync("↑%s ", formatNumber(repo.Unpushed))
+			}
+			if repo.Unpulled > 0 {
+				sync("↓%s ", formatNumber(repo.Unpulled))
+			}
+			if repo.PRReady {
+				sync("%s ", tr("push me"))
+			}
+			printDrift(w, repo)
+			if repo.Pending {
+				fmt.Fprintf(w, "%s ", tr("pending"))
+			}
+			if repo.Unavailable {
+				alert("%s ", tr("unavailable"))
+			}
+			if repo.Missing != "" {
+				alert("%s ", tr(repo.Missing))
+			}
+			if repo.Empty {
+				changes("%s ", tr("empty"))
+			}
+			if repo.MissingRefs > 0 {
+				alert("%s ", trn("{{.Count}} ref missing", "{{.Count}} refs missing", repo.MissingRefs))
+			}
+			if repo.Staged > 0 || repo.Modified > 0 || repo.Untracked > 0 {
+				if repo.Staged > 0 {
+					clean("+%s ", formatNumber(repo.Staged))
+				}
+				if repo.Modified > 0 {
+					changes("~%s ", formatNumber(repo.Modified))
+				}
+				if repo.Untracked > 0 {
+					paint(theme.Stale...)("?%s ", formatNumber(repo.Untracked))
+				}
+			} else if repo.Deltas > 0 {
+				changes("∆%s ", formatNumber(repo.Deltas))
+			}
+			if repo.ModeChanges > 0 {
+				changes("%s ", tr("(%s mode only)", formatNumber(repo.ModeChanges)))
+			}
+			if repo.LineEndings > 0 {
+				changes("%s ", tr("(%s line endings only)", formatNumber(repo.LineEndings)))
+			}
+			if repo.CaseRenames > 0 {
+				changes("%s ", trn("({{.Count}} case rename)", "({{.Count}} case renames)", repo.CaseRenames))
+			}
+			if repo.Stashes > 0 {
+				changes("⚑%s ", formatNumber(repo.Stashes))
+			}
+			if repo.UntrackedSkipped {
+				fmt.Fprintf(w, "%s ", tr("untracked not checked"))
+			}
+			if repo.Sparse {
+				fmt.Fprintf(w, "%s ", tr("sparse"))
+			}
+			if repo.UnsafeOwnership {
+				alert("%s", tr("unsafe ownership, see -fix-safe-directory"))
+			}
+			if repo.Operation != "" {
+				alert("%s ", tr("%s in progress", tr(repo.Operation)))
+			}
+			if repo.Permissions != "" {
+				alert("%s ", repo.Permissions)
+			}
+			if repo.AuthRequired {
+				alert("%s ", tr("auth required"))
+			} else if repo.RemoteUnreachable {
+				alert("%s ", tr("unreachable"))
+			}
+			printBranchCount(w, repo, paint)
+			if repo.Release != "" {
+				fmt.Fprintf(w, "%s ", repo.Release)
+			}
+			printActivity(w, repo)
+			if config.Report.Actions {
+				fmt.Fprintf(w, "→ %s ", strings.Join(suggestActions(repo), ", "))
+			}
+			if repo.Note != "" {
+				fmt.Fprintf(w, "# %s", repo.Note)
+			}
+			fmt.Fprintln(w)
+		} else if all {
+			fmt.Fprintf(w, "%-"+strconv.Itoa(nameWidth)+"s (%-"+strconv.Itoa(branchWidth)+"s) ", repo.Name, branch)
+			clean("✔ ")
+			if repo.Untracked > 0 {
+				// Only left here by report.ignore_untracked
+				paint(theme.Stale...)("?%s ", formatNumber(repo.Untracked))
+			}
+			if repo.UntrackedSkipped {
+				fmt.Fprintf(w, "%s ", tr("untracked not checked"))
+			}
+			if repo.Sparse {
+				fmt.Fprintf(w, "%s ", tr("sparse"))
+			}
+			if repo.Acknowledged {
+				fmt.Fprintf(w, "%s ", tr("acknowledged"))
+			}
+			if !repo.SnoozedUntil.IsZero() {
+				fmt.Fprintf(w, "%s ", tr("snoozed until %s", formatDate(repo.SnoozedUntil)))
+			}
+			printBranchCount(w, repo, paint)
+			if repo.Release != "" {
+				fmt.Fprintf(w, "%s ", repo.Release)
+			}
+			printActivity(w, repo)
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// printBranchCount shows the local branches and how many of them have no
+// upstream, once there is more than one branch to keep track of
+func printBranchCount(w io.Writer, repo RepoStatus, paint func(...color.Attribute) func(string, ...interface{})) {
+	if repo.Branches <= 1 && repo.UntrackedBranches == 0 {
+		return
+	}
+	if hasStaleBranches(repo) {
+		paint(theme.Stale...)("⎇ %d/%d ", repo.Branches, repo.UntrackedBranches)
+	} else {
+		fmt.Fprintf(w, "⎇ %d/%d ", repo.Branches, repo.UntrackedBranches)
+	}
+}
+
+func hasStaleBranches(repo RepoStatus) bool {
+	return config.Branches.MaxUntracked > 0 && repo.UntrackedBranches > config.Branches.MaxUntracked
+}
+
+// suggestActions turns a flagged status into what to do about it, the most
+// pressing first
+func suggestActions(repo RepoStatus) []string {
+	var actions []string
+	if repo.UnsafeOwnership {
+		return []string{tr("fix ownership")}
+	}
+	if repo.Unavailable {
+		return []string{tr("check the mount")}
+	}
+	if repo.Missing != "" {
+		return []string{tr("clone it")}
+	}
+	if repo.Operation != "" {
+		actions = append(actions, tr("resolve %s", tr(repo.Operation)))
+	}
+	if isChurnOnly(repo) {
+		actions = append(actions, tr("renormalize"))
+	} else if repo.Deltas > 0 || repo.Empty {
+		actions = append(actions, tr("commit"))
+	}
+	if repo.MissingRefs > 0 {
+		actions = append(actions, tr("fetch"))
+	}
+	if repo.Permissions != "" {
+		actions = append(actions, tr("fix permissions"))
+	}
+	if repo.Stashes > 0 {
+		actions = append(actions, tr("apply or drop stashes"))
+	}
+	if repo.Detached != "" && repo.Operation == "" {
+		actions = append(actions, tr("check out a branch"))
+	}
+	if repo.RemoteBranchError && repo.Operation == "" {
+		actions = append(actions, tr("set upstream"))
+	}
+	if repo.AuthRequired {
+		actions = append(actions, tr("sign in"))
+	} else if repo.RemoteUnreachable {
+		actions = append(actions, tr("check remote"))
+	}
+	if repo.Unpulled > 0 && !getTagRules(repo.Path).IgnoreBehind {
+		actions = append(actions, tr("pull"))
+	}
+	if repo.PRReady {
+		actions = append(actions, tr("push and open a PR"))
+	} else if repo.Unpushed > 0 {
+		actions = append(actions, tr("push"))
+	}
+	if hasStaleBranches(repo) {
+		actions = append(actions, tr("prune branches"))
+	}
+	return actions
+}
+
+func getStatus(repo string) RepoStatus {
+	backend := getBackend(repo)
+	if backend == nil {
+		return RepoStatus{Path: repo}
+	}
+	rules := getTagRules(repo)
+
+	var fetchErr error
+	if fetcher, ok := backend.(Fetcher); ok && (rules.Fetch || fetchAll) && config.Checks.Remote {
+		fetchErr = fetcher.Fetch(repo)
+	}
+	status := backend.Status(repo)
+	status.Path = repo
+	status.Note = getNote(repo)
+	if repoConfig, ok := config.Repos[repo]; ok && repoConfig.Alias != "" {
+		status.Name = repoConfig.Alias
+	}
+	if (sortBy == "activity" || idleFor > 0) && (gitBackend{}).Detect(repo) {
+		status.LastActivity = getLastActivity(repo)
+	}
+	if fetchErr != nil {
+		status.RemoteUnreachable = true
+		status.AuthRequired = isAuthError(fetchErr)
+	}
+
+	status.ShouldReport = status.Unpushed > 0 || status.Deltas > 0 || status.RemoteBranchError ||
+		status.RemoteUnreachable || status.UnsafeOwnership || status.Operation != "" || status.Empty || status.MissingRefs > 0 || hasStaleBranches(status) || status.Permissions != "" || status.Stashes > 0 || status.Detached != "" ||
+		status.Unpulled > 0 && !rules.IgnoreBehind
+	applyAck(&status)
+	applySnooze(&status)
+	return status
+}
+
+type gitBackend struct{}
+
+func (gitBackend) Detect(dir string) bool {
+	dotgitpath := path.Join(dir, ".git")
+	dotgit, err := os.Stat(dotgitpath)
+	if err != nil || !dotgit.IsDir() {
+		return false
+	}
+	return true
+}
+
+func (gitBackend) Status(repo string) (status RepoStatus) {
+	if isUnsafeRepo(repo) {
+		status.Name = path.Base(repo)
+		status.UnsafeOwnership = true
+		return status
+	}
+
+	var err error
+	status.Name = getCachedRepoName(repo)
+	if branch, empty := getUnbornBranch(repo); empty {
+		// Nothing to compare with an upstream until the first commit
+		status.Empty = true
+		status.RemoteBranch = branch
+		if config.Checks.Worktree {
+			status.Deltas = getDeltas(repo)
+		}
+		return status
+	}
+	status.Detached = getDetachedHead(repo)
+	if status.Detached != "" {
+		// Only branches have an upstream to compare with
+	} else if config.Checks.Remote {
+		status.RemoteBranch, err = getRemote(repo)
+		status.RemoteBranchError = err != nil
+		status.Unpulled, status.Unpushed = getAheadBehind(repo, status.RemoteBranch)
+		if push, err := getPushBranch(repo); err == nil && push != status.RemoteBranch && !status.RemoteBranchError {
+			// Triangular workflows pull from one remote and push to another
+			status.PushBranch = push
+			_, status.Unpushed = getAheadBehind(repo, push)
+		}
+		if status.Unpulled > 0 || status.Unpushed > 0 {
+			status.DivergedSince = getDivergedSince(repo, status.RemoteBranch)
+		}
+	} else {
+		status.RemoteBranch, _ = getCmdOutput(repo, "git", "symbolic-ref", "--short", "-q", "HEAD")
+	}
+	// git status already leaves out what is outside a sparse checkout's
+	// cone, the badge says why the counts may look low
+	status.Sparse = isSparse(repo)
+	if config.Checks.Worktree {
+		status.Deltas, status.Staged, status.Modified, status.Untracked = getDeltaCounts(repo)
+		status.UntrackedSkipped = contains(getDeltaArgs(repo), "--untracked-files=no")
+		if status.Deltas > 0 && !config.Report.IgnoreModeChanges {
+			status.ModeChanges = getModeChanges(repo)
+		}
+		if status.Deltas > 0 && config.Checks.Churn {
+			status.LineEndings, status.CaseRenames = getChurn(repo)
+		}
+	}
+	if config.Report.Release {
+		status.Release = getRelease(repo)
+	}
+	status.Branches, status.UntrackedBranches = getBranchCounts(repo)
+	status.Operation = getOperation(repo)
+	status.Stashes = getStashes(repo)
+	if config.Report.PRReadyAfter > 0 && config.Checks.Worktree && status.Unpushed > 0 && status.Deltas == 0 && status.Operation == "" {
+		// Finished work that was never pushed for review
+		committed := getCommitTime(repo, "HEAD")
+		status.PRReady = !committed.IsZero() && clock().Sub(committed) >= config.Report.PRReadyAfter
+	}
+	if config.Checks.Permissions {
+		status.Permissions = auditPermissions(repo)
+	}
+	if config.Remote.Check && config.Checks.Remote {
+		status.RemoteUnreachable, status.AuthRequired = checkRemoteReachable(repo)
+	}
+
+	return status
+}
+
+func (gitBackend) Fetch(repo string) error {
+	_, err := getNetworkCmdOutput(config.Fetch.Timeout, repo, "git", "fetch", "--quiet")
+	return err
+}
+
+// getStashes counts the stashes, work set aside that is easily forgotten
+func getStashes(repo string) int {
+	raw, err := getCmdOutput(repo, "git", "stash", "list")
+	if err != nil {
+		return 0
+	}
+	return countLines(raw)
+}
+
+// getOperation reports a rebase, merge, cherry-pick or revert that was
+// started and never finished
+func getOperation(repo string) string {
+	gitDir, err := getCmdOutput(repo, "git", "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return ""
+	}
+	markers := []struct{ file, operation string }{
+		{"rebase-merge", "rebase"},
+		{"rebase-apply", "rebase"},
+		{"MERGE_HEAD", "merge"},
+		{"CHERRY_PICK_HEAD", "cherry-pick"},
+		{"REVERT_HEAD", "revert"},
+	}
+	for _, marker := range markers {
+		if _, err := os.Stat(filepath.Join(gitDir, marker.file)); err == nil {
+			return marker.operation
+		}
+	}
+	return ""
+}
+
+// isUnsafeRepo checks whether git refuses to work in repo because it is owned
+// by someone else and isn't listed in safe.directory
+func isUnsafeRepo(repo string) bool {
+	_, err := getCmdOutput(repo, "git", "rev-parse", "--git-dir")
+	var cmdErr *cmdError
+	return errors.As(err, &cmdErr) && strings.Contains(cmdErr.Stderr, "detected dubious ownership")
+}
+
+func fixSafeDirectories() {
+	var unsafe []string
+	for _, path := range registered {
+		if len(path) == 0 || strings.HasPrefix(path, commentIndicator) {
+			continue
+		}
+		if (gitBackend{}).Detect(path) && isUnsafeRepo(path) {
+			unsafe = append(unsafe, path)
+		}
+	}
+	if len(unsafe) == 0 {
+		fmt.Println("No repos are refused for ownership")
+		return
+	}
+	for _, path := range unsafe {
+		if !confirm("Add " + path + " to safe.directory in your global git config?") {
+			continue
+		}
+		_, err := getCmdOutput(path, "git", "config", "--global", "--add", "safe.directory", path)
+		if err != nil {
+			fmt.Println("error updating safe.directory:", err.Error())
+		}
+	}
+}
+
+// stdin is shared so answers piped in aren't lost to a discarded buffer
+var stdin = bufio.NewReader(os.Stdin)
+
+// confirm asks a yes/no question on stdin, anything but yes is a no
+func confirm(question string) bool {
+	fmt.Print(question + " [y/N] ")
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// getRepoName names a repo after its remote's URL, preferring the remote
+// set with remote= in its config, then origin, then the first remote. Repos
+// without remotes are named after their directory.
+func getRepoName(repo string) string {
+	url := ""
+	remote := getPreferredRemote(repo)
+	if remote != "" {
+		url, _ = getCmdOutput(repo, "git", "config", "--get", "remote."+remote+".url")
+	}
+	url = strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git")
+	if url == "" {
+		return filepath.Base(repo)
+	}
+	if slash := strings.LastIndexAny(url, "/:"); slash != -1 {
+		url = url[slash+1:]
+	}
+	return url
+}
+
+// getPreferredRemote picks the remote to use when a branch doesn't say
+func getPreferredRemote(repo string) string {
+	if repoConfig, ok := config.Repos[repo]; ok && repoConfig.Remote != "" {
+		return repoConfig.Remote
+	}
+	raw, err := getCmdOutput(repo, "git", "remote")
+	if err != nil || raw == "" {
+		return ""
+	}
+	remotes := strings.Split(raw, "\n")
+	if contains(remotes, "origin") {
+		return "origin"
+	}
+	return remotes[0]
+}
+
+// getUnbornBranch detects a repo without commits yet, returning the branch
+// its first commit will go to
+func getUnbornBranch(repo string) (string, bool) {
+	_, err := getCmdOutput(repo, "git", "rev-parse", "--verify", "-q", "HEAD")
+	if err == nil {
+		return "", false
+	}
+	branch, err := getCmdOutput(repo, "git", "symbolic-ref", "--short", "-q", "HEAD")
+	return branch, err == nil
+}
+
+// getDetachedHead is the abbreviated commit HEAD points at when no branch
+// is checked out, and empty on a branch
+func getDetachedHead(repo string) string {
+	if _, err := getCmdOutput(repo, "git", "symbolic-ref", "-q", "HEAD"); err == nil {
+		return ""
+	}
+	commit, err := getCmdOutput(repo, "git", "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return commit
+}
+
+// getPushBranch is where git push would send the current branch, which
+// only differs from the upstream with push.default or a pushRemote set
+func getPushBranch(repo string) (string, error) {
+	return getCmdOutput(repo, "git", "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{push}")
+}
+
+func getRemote(repo string) (string, error) {
+	if repoConfig, ok := config.Repos[repo]; ok && repoConfig.Branch != "" {
+		_, err := getCmdOutput(repo, "git", "rev-parse", "--verify", "-q", repoConfig.Branch)
+		if err != nil {
+			return "", err
+		}
+		return repoConfig.Branch, nil
+	}
+	raw, err := getCmdOutput(repo, "git", "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// getUpstreamRemote finds the remote the current branch tracks, falling
+// back on origin for detached heads and branches without an upstream
+func getUpstreamRemote(repo string) string {
+	branch, err := getCmdOutput(repo, "git", "symbolic-ref", "--short", "-q", "HEAD")
+	if err == nil {
+		remote, err := getCmdOutput(repo, "git", "config", "--get", "branch."+branch+".remote")
+		if err == nil && remote != "" {
+			return remote
+		}
+	}
+	if remote := getPreferredRemote(repo); remote != "" {
+		return remote
+	}
+	return "origin"
+}
+
+// checkRemoteReachable checks that the remote answers and accepts our
+// credentials. An exit code of 2 only means the remote has no matching refs.
+func checkRemoteReachable(repo string) (unreachable bool, authRequired bool) {
+	remote := getUpstreamRemote(repo)
+	_, err := getNetworkCmdOutput(config.Remote.Timeout, repo, "git", "ls-remote", "--exit-code", remote, "HEAD")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+		return false, false
+	}
+	return err != nil, isAuthError(err)
+}
+
+var authErrors = []string{
+	"terminal prompts disabled",
+	"could not read Username",
+	"could not read Password",
+	"Authentication failed",
+	"Permission denied (publickey",
+	"Host key verification failed",
+	"The requested URL returned error: 401",
+	"The requested URL returned error: 403",
+}
+
+func isAuthError(err error) bool {
+	var cmdErr *cmdError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	for _, message := range authErrors {
+		if strings.Contains(cmdErr.Stderr, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAheadBehind counts both sides with a single rev-list, so the two
+// numbers always come from the same view of the refs
+func getAheadBehind(repo string, remote string) (unpulled int, unpushed int) {
+	raw, err := getCmdOutput(repo, "git", "rev-list", "--left-right", "--count", remote+"...HEAD")
+	if err != nil {
+		fmt.Println("error getting ahead/behind counts:", err.Error())
+		return -1, -1
+	}
+	counts := strings.Fields(raw)
+	if len(counts) != 2 {
+		fmt.Println("error getting ahead/behind counts: unexpected output", raw)
+		return -1, -1
+	}
+	unpulled, _ = strconv.Atoi(counts[0])
+	unpushed, _ = strconv.Atoi(counts[1])
+	return unpulled, unpushed
+}
+
+// getBranchCounts counts the local branches and those without an upstream
+func getBranchCounts(repo string) (branches int, untracked int) {
+	raw, err := getCmdOutput(repo, "git", "for-each-ref", "--format=%(refname)%09%(upstream)", "refs/heads")
+	if err != nil {
+		fmt.Println("error getting branch count:", err.Error())
+		return 0, 0
+	}
+	if raw == "" {
+		return 0, 0
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		branches++
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+			untracked++
+		}
+	}
+	return branches, untracked
+}
+
+// getDeltas counts the changed files, leaving out what the repo's own
+// .git-status.toml says to treat as clean
+func getDeltas(repo string) int {
+	deltas, _, _, _ := getDeltaCounts(repo)
+	return deltas
+}
+
+// getDeltaCounts also splits the changed files into staged, modified in the
+// worktree and untracked, a file with both staged and unstaged changes
+// counting as both. Untracked files are left out of the total with
+// report.ignore_untracked.
+func getDeltaCounts(repo string) (deltas int, staged int, modified int, untracked int) {
+	args := getDeltaArgs(repo)
+	v2 := make([]string, len(args))
+	for i, arg := range args {
+		v2[i] = arg
+		if arg == "--porcelain" {
+			// v2 marks an unchanged side with a dot rather than a space
+			// that trimming the output would lose
+			v2[i] = "--porcelain=v2"
+		}
+	}
+	raw, err := getCmdOutput(repo, "git", v2...)
+	parse := countPorcelainV2
+	if err != nil {
+		// git before 2.11 only knows the original format
+		raw, err = getCmdOutput(repo, "git", args...)
+		parse = countPorcelainV1
+	}
+	if err != nil {
+		fmt.Println("error getting deltas count:", err.Error())
+		return -1, 0, 0, 0
+	}
+	if raw == "" {
+		return 0, 0, 0, 0
+	}
+	staged, modified, untracked = parse(raw)
+	deltas = countLines(raw)
+	if config.Report.IgnoreUntracked {
+		deltas -= untracked
+	}
+	return deltas, staged, modified, untracked
+}
+
+func countPorcelainV2(raw string) (staged int, modified int, untracked int) {
+	for _, line := range strings.Split(raw, "\n") {
+		switch {
+		case strings.HasPrefix(line, "? "):
+			untracked++
+		case len(line) > 4 && (line[0] == '1' || line[0] == '2' || line[0] == 'u'):
+			if line[2] != '.' {
+				staged++
+			}
+			if line[3] != '.' {
+				modified++
+			}
+		}
+	}
+	return staged, modified, untracked
+}
+
+// porcelainLines splits git status --porcelain or --short output into its
+// "XY path" lines, where a space is an unchanged side. Trimming the output
+// takes the space off a first line like " M path", which is put back since
+// the status is always followed by a space.
+func porcelainLines(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	lines := strings.Split(raw, "\n")
+	if line := lines[0]; len(line) > 2 && line[1] == ' ' && line[2] != ' ' {
+		lines[0] = " " + line
+	}
+	return lines
+}
+
+// countPorcelainV1 reads the output of git status --porcelain
+func countPorcelainV1(raw string) (staged int, modified int, untracked int) {
+	for _, line := range porcelainLines(raw) {
+		switch {
+		case strings.HasPrefix(line, "?? "):
+			untracked++
+		case len(line) > 3:
+			if line[0] != ' ' {
+				staged++
+			}
+			if line[1] != ' ' {
+				modified++
+			}
+		}
+	}
+	return staged, modified, untracked
+}
+
+func isSparse(repo string) bool {
+	sparse, _ := getCmdOutput(repo, "git", "config", "--bool", "core.sparseCheckout")
+	return sparse == "true"
+}
+
+// getModeChanges counts the files whose only change is their permissions,
+// as happens after copying a repo between filesystems. The raw records give
+// the old and new modes, and a numstat of no lines added or removed says the
+// content is the same. Diffing against HEAD counts staged changes too, and
+// -z keeps paths as they are, spaces and all.
+func getModeChanges(repo string) int {
+	raw, err := getCmdOutput(repo, "git", "diff", "HEAD", "--no-renames", "--raw", "--numstat", "-z")
+	if err != nil {
+		return 0
+	}
+	modeChanged := map[string]bool{}
+	count := 0
+	records := strings.Split(raw, "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if strings.HasPrefix(record, ":") {
+			// :old-mode new-mode old-sha new-sha status, then the path.
+			// Unmerged, added and deleted files have a mode of zeros.
+			fields := strings.Fields(record[1:])
+			if i+1 < len(records) && len(fields) == 5 && fields[0] != fields[1] &&
+				fields[0] != "000000" && fields[1] != "000000" && fields[4] == "M" {
+				modeChanged[records[i+1]] = true
+			}
+			i++
+			continue
+		}
+		stat := strings.SplitN(record, "\t", 3)
+		if len(stat) == 3 && stat[0] == "0" && stat[1] == "0" && modeChanged[stat[2]] {
+			count++
+		}
+	}
+	return count
+}
+
+// getDeltaArgs builds the status command for a repo, honoring the ignore
+// rules from its own config file and from its [repo] table in ours. A
+// pathspec there limits the check to part of the tree.
+func getDeltaArgs(repo string) []string {
+	repoFile := loadRepoFile(repo)
+	repoConfig, ok := config.Repos[repo]
+	if !ok {
+		repoConfig = &RepoConfig{}
+	}
+	args := []string{"status", "--porcelain"}
+	if config.Report.IgnoreModeChanges {
+		args = append([]string{"-c", "core.fileMode=false"}, args...)
+	}
+	if repoFile.IgnoreUntracked || repoConfig.IgnoreUntracked {
+		args = append(args, "--untracked-files=no")
+	}
+	args = append(args, "--")
+	if len(repoConfig.Pathspec) != 0 {
+		args = append(args, repoConfig.Pathspec...)
+	} else {
+		args = append(args, ".")
+	}
+	for _, pattern := range append(repoFile.Ignore, repoConfig.Ignore...) {
+		args = append(args, ":(exclude,glob)"+pattern)
+	}
+	return args
+}
+
+// cmdError x
+type cmdError struct {
+	Err    error
+	Stderr string
+}
+
+func (err *cmdError) Error() string {
+	if err.Stderr == "" {
+		return err.Err.Error()
+	}
+	return err.Err.Error() + ": " + strings.SplitN(err.Stderr, "\n", 2)[0]
+}
+
+func (err *cmdError) Unwrap() error {
+	return err.Err
+}
+
+func getCmdOutput(workingDir string, name string, arg ...string) (string, error) {
+	return getCmdOutputTimeout(0, workingDir, name, arg...)
+}
+
+// getNetworkCmdOutput runs a command that talks to a remote. Anything that
+// would prompt for credentials fails instead, so a repo needing a password
+// can't hang the whole run waiting for input.
+func getNetworkCmdOutput(timeout time.Duration, workingDir string, name string, arg ...string) (string, error) {
+	env := append(repoEnv(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ASKPASS=true",
+		"SSH_ASKPASS=true",
+		"GCM_INTERACTIVE=never",
+	)
+	if os.Getenv("GIT_SSH_COMMAND") == "" && os.Getenv("GIT_SSH") == "" {
+		ssh, err := getCmdOutput(workingDir, "git", "config", "--get", "core.sshCommand")
+		if err != nil || ssh == "" {
+			ssh = "ssh"
+		}
+		env = append(env, "GIT_SSH_COMMAND="+ssh+" -o BatchMode=yes"+getMultiplexOptions())
+	}
+	return getCmdOutputEnv(timeout, env, workingDir, name, arg...)
+}
+
+var controlDir string
+var controlDirOnce sync.Once
+
+// getMultiplexOptions has ssh share one connection per host across the
+// repos of a run, and keep it a minute for the next run, instead of paying
+// for a handshake on every fetch
+func getMultiplexOptions() string {
+	if !config.Fetch.SSHMultiplex {
+		return ""
+	}
+	controlDirOnce.Do(func() {
+		dir := filepath.Join(stateDir, "ssh")
+		// Socket paths are limited to around a hundred bytes, %C adds 40
+		if len(dir) > 60 || os.MkdirAll(dir, 0700) != nil {
+			return
+		}
+		controlDir = dir
+	})
+	if controlDir == "" {
+		return ""
+	}
+	return " -o ControlMaster=auto -o ControlPersist=60s -o " + shellQuote("ControlPath="+filepath.Join(controlDir, "%C"))
+}
+
+// getCmdOutputTimeout runs a command, killing it once timeout elapses. A zero
+// timeout waits for as long as the command takes.
+func getCmdOutputTimeout(timeout time.Duration, workingDir string, name string, arg ...string) (string, error) {
+	return getCmdOutputEnv(timeout, repoEnv(), workingDir, name, arg...)
+}
+
+// repoLocalEnv are the variables git itself clears when it moves into another
+// repo, see git rev-parse --local-env-vars. Left set, say when run from a hook
+// or alias, they would point every registered repo at the same one.
+var repoLocalEnv = []string{
+	"GIT_ALTERNATE_OBJECT_DIRECTORIES",
+	"GIT_CONFIG",
+	"GIT_CONFIG_PARAMETERS",
+	"GIT_CONFIG_COUNT",
+	"GIT_OBJECT_DIRECTORY",
+	"GIT_DIR",
+	"GIT_WORK_TREE",
+	"GIT_IMPLICIT_WORK_TREE",
+	"GIT_GRAFT_FILE",
+	"GIT_INDEX_FILE",
+	"GIT_NO_REPLACE_OBJECTS",
+	"GIT_REPLACE_REF_BASE",
+	"GIT_PREFIX",
+	"GIT_SHALLOW_FILE",
+	"GIT_COMMON_DIR",
+}
+
+// repoEnv is the environment without overrides that would stop git from
+// reading each repo's own config, including its includeIf sections
+func repoEnv() []string {
+	var env []string
+	for _, pair := range os.Environ() {
+		name := strings.SplitN(pair, "=", 2)[0]
+		if contains(repoLocalEnv, name) ||
+			strings.HasPrefix(name, "GIT_CONFIG_KEY_") || strings.HasPrefix(name, "GIT_CONFIG_VALUE_") {
+			continue
+		}
+		env = append(env, pair)
+	}
+	return env
+}
+
+func getCmdOutputEnv(timeout time.Duration, env []string, workingDir string, name string, arg ...string) (string, error) {
+	return runner.Run(timeout, env, workingDir, name, arg...)
 }
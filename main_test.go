@@ -0,0 +1,456 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFixtures answers commands from outputs, failing those in failing, for
+// the rest of the test
+func useFixtures(t *testing.T, outputs map[string]string, failing ...string) *fakeRunner {
+	fake := &fakeRunner{Outputs: outputs, Errors: map[string]error{}}
+	for _, command := range failing {
+		fake.Errors[command] = errors.New("exit status 128")
+	}
+	previousRunner, previousConfig := runner, config
+	runner, config = fake, newConfig()
+	t.Cleanup(func() {
+		runner, config = previousRunner, previousConfig
+	})
+	return fake
+}
+
+// useTempSettings points the store, config and state dir at a temp dir
+// and starts from an empty registry and default config, for the rest of
+// the test. It returns the dir.
+func useTempSettings(t *testing.T) string {
+	previousStore, previousConfigFile, previousStateDir := store, configFile, stateDir
+	previousRegistered, previousConfig, previousOptions := registered, config, storeOptions
+	previousState, previousLoaded, previousDirty := state, stateLoaded, stateDirty
+	t.Cleanup(func() {
+		store, configFile, stateDir = previousStore, previousConfigFile, previousStateDir
+		registered, config, storeOptions = previousRegistered, previousConfig, previousOptions
+		state, stateLoaded, stateDirty = previousState, previousLoaded, previousDirty
+	})
+	dir := t.TempDir()
+	store = filepath.Join(dir, "repos")
+	configFile = filepath.Join(dir, "config.toml")
+	stateDir = filepath.Join(dir, "state")
+	registered, config, storeOptions = nil, newConfig(), map[string][]tomlEntry{}
+	state, stateLoaded, stateDirty = State{}, false, false
+	return dir
+}
+
+// writeStore registers paths, moving the store's modification time on so
+// watchers notice even within the filesystem's timestamp granularity
+func writeStore(t *testing.T, paths ...string) {
+	var previous time.Time
+	if info, err := os.Stat(store); err == nil {
+		previous = info.ModTime()
+	}
+	if err := os.WriteFile(store, formatStore(paths), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !previous.IsZero() {
+		later := previous.Add(time.Second)
+		if err := os.Chtimes(store, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// initRepo creates a git repo with one commit
+func initRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	repo := t.TempDir()
+	gitIn(t, repo, "init", "-q")
+	commitIn(t, repo, "first")
+	return repo
+}
+
+// gitIn runs git in repo, failing the test when it fails
+func gitIn(t *testing.T, repo string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repo
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commitIn commits whatever is staged, or nothing
+func commitIn(t *testing.T, repo string, message string) {
+	gitIn(t, repo, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", message)
+}
+
+const statusV2 = "git status --porcelain=v2 -- ."
+const statusV1 = "git status --porcelain -- ."
+
+func TestGetDeltaCountsV2(t *testing.T) {
+	tests := []struct {
+		name                                string
+		output                              string
+		deltas, staged, modified, untracked int
+	}{
+		{"clean", "", 0, 0, 0, 0},
+		{"modified", "1 .M N... 100644 100644 100644 a1 a1 README", 1, 0, 1, 0},
+		{"staged", "1 A. N... 000000 100644 100644 00 b2 new.go", 1, 1, 0, 0},
+		{"staged and modified", "1 MM N... 100644 100644 100644 a1 b2 main.go", 1, 1, 1, 0},
+		{"rename", "2 R. N... 100644 100644 100644 a1 a1 R100 new name.go\told name.go", 1, 1, 0, 0},
+		{"unmerged", "u UU N... 100644 100644 100644 100644 a1 b2 c3 conflict.go", 1, 1, 1, 0},
+		{"untracked", "? notes.txt\n? build/", 2, 0, 0, 2},
+		{"mixed", "1 .M N... 100644 100644 100644 a1 a1 README\n1 D. N... 100644 000000 000000 a1 00 gone\n? new", 3, 1, 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useFixtures(t, map[string]string{statusV2: test.output})
+			deltas, staged, modified, untracked := getDeltaCounts(t.TempDir())
+			if deltas != test.deltas || staged != test.staged || modified != test.modified || untracked != test.untracked {
+				t.Errorf("got %d %d %d %d, want %d %d %d %d", deltas, staged, modified, untracked,
+					test.deltas, test.staged, test.modified, test.untracked)
+			}
+		})
+	}
+}
+
+func TestGetDeltaCountsV1(t *testing.T) {
+	tests := []struct {
+		name                                string
+		output                              string
+		deltas, staged, modified, untracked int
+	}{
+		{"modified first", "M README\n?? notes.txt", 2, 0, 1, 1},
+		{"staged", "A  new.go", 1, 1, 0, 0},
+		{"staged and modified", "MM main.go", 1, 1, 1, 0},
+		{"rename", "R  old name.go -> new name.go", 1, 1, 0, 0},
+		{"unmerged", "UU conflict.go\nAA both.go", 2, 2, 2, 0},
+		{"untracked", "?? notes.txt\n?? build/", 2, 0, 0, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Old versions of git reject --porcelain=v2
+			useFixtures(t, map[string]string{statusV1: test.output}, statusV2)
+			deltas, staged, modified, untracked := getDeltaCounts(t.TempDir())
+			if deltas != test.deltas || staged != test.staged || modified != test.modified || untracked != test.untracked {
+				t.Errorf("got %d %d %d %d, want %d %d %d %d", deltas, staged, modified, untracked,
+					test.deltas, test.staged, test.modified, test.untracked)
+			}
+		})
+	}
+}
+
+func TestGetDeltaCountsError(t *testing.T) {
+	useFixtures(t, map[string]string{}, statusV2, statusV1)
+	deltas, staged, modified, untracked := getDeltaCounts(t.TempDir())
+	if deltas != -1 || staged != 0 || modified != 0 || untracked != 0 {
+		t.Errorf("got %d %d %d %d, want -1 0 0 0", deltas, staged, modified, untracked)
+	}
+}
+
+func TestGetDeltaCountsIgnoreUntracked(t *testing.T) {
+	useFixtures(t, map[string]string{statusV2: "1 .M N... 100644 100644 100644 a1 a1 README\n? notes.txt"})
+	config.Report.IgnoreUntracked = true
+	deltas, _, _, untracked := getDeltaCounts(t.TempDir())
+	if deltas != 1 || untracked != 1 {
+		t.Errorf("got %d deltas and %d untracked, want 1 and 1", deltas, untracked)
+	}
+}
+
+func TestGetAheadBehind(t *testing.T) {
+	const command = "git rev-list --left-right --count origin/main...HEAD"
+	tests := []struct {
+		name               string
+		output             string
+		fail               bool
+		unpulled, unpushed int
+	}{
+		{"even", "0\t0", false, 0, 0},
+		{"diverged", "3\t5", false, 3, 5},
+		{"unexpected output", "3", false, -1, -1},
+		{"git fails", "", true, -1, -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var failing []string
+			if test.fail {
+				failing = append(failing, command)
+			}
+			useFixtures(t, map[string]string{command: test.output}, failing...)
+			unpulled, unpushed := getAheadBehind("/repo", "origin/main")
+			if unpulled != test.unpulled || unpushed != test.unpushed {
+				t.Errorf("got %d %d, want %d %d", unpulled, unpushed, test.unpulled, test.unpushed)
+			}
+		})
+	}
+}
+
+func TestGetBranchCounts(t *testing.T) {
+	const command = "git for-each-ref --format=%(refname)%09%(upstream) refs/heads"
+	tests := []struct {
+		name                string
+		output              string
+		fail                bool
+		branches, untracked int
+	}{
+		{"none", "", false, 0, 0},
+		{"tracked", "refs/heads/main\trefs/remotes/origin/main", false, 1, 0},
+		{"mixed", "refs/heads/main\trefs/remotes/origin/main\nrefs/heads/wip\t\nrefs/heads/spike", false, 3, 2},
+		{"git fails", "", true, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var failing []string
+			if test.fail {
+				failing = append(failing, command)
+			}
+			useFixtures(t, map[string]string{command: test.output}, failing...)
+			branches, untracked := getBranchCounts("/repo")
+			if branches != test.branches || untracked != test.untracked {
+				t.Errorf("got %d %d, want %d %d", branches, untracked, test.branches, test.untracked)
+			}
+		})
+	}
+}
+
+func TestRepoEnvStripsRepoLocalVariables(t *testing.T) {
+	t.Setenv("GIT_DIR", "/elsewhere/.git")
+	t.Setenv("GIT_WORK_TREE", "/elsewhere")
+	t.Setenv("GIT_INDEX_FILE", "/elsewhere/.git/index")
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "user.name")
+	t.Setenv("GIT_CONFIG_VALUE_0", "someone else")
+	t.Setenv("GIT_CONFIG_PARAMETERS", "'user.name'='someone else'")
+	t.Setenv("GIT_AUTHOR_NAME", "kept")
+	env := repoEnv()
+	for _, pair := range env {
+		name := strings.SplitN(pair, "=", 2)[0]
+		if name == "GIT_DIR" || name == "GIT_WORK_TREE" || name == "GIT_INDEX_FILE" ||
+			strings.HasPrefix(name, "GIT_CONFIG_") {
+			t.Errorf("%s was passed on", pair)
+		}
+	}
+	if !contains(env, "GIT_AUTHOR_NAME=kept") {
+		t.Error("GIT_AUTHOR_NAME was dropped")
+	}
+}
+
+// TestRepoEnvHonoursIncludeIf runs real git, as if from a hook in another
+// repo, to check a repo still picks up its own conditional config
+func TestRepoEnvHonoursIncludeIf(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	home := t.TempDir()
+	repo := filepath.Join(t.TempDir(), "work")
+	other := filepath.Join(t.TempDir(), "other")
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, dir := range []string{repo, other} {
+		if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+			t.Fatalf("git init: %v: %s", err, out)
+		}
+	}
+	global := "[user]\n\tname = global\n[includeIf \"gitdir:" + repo + "/\"]\n\tpath = " +
+		filepath.Join(home, "work.gitconfig") + "\n"
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte(global), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "work.gitconfig"), []byte("[user]\n\tname = work\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIT_DIR", filepath.Join(other, ".git"))
+	t.Setenv("GIT_WORK_TREE", other)
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "user.name")
+	t.Setenv("GIT_CONFIG_VALUE_0", "override")
+
+	name, err := getCmdOutput(repo, "git", "config", "user.name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "work" {
+		t.Errorf("got user.name %q, want %q", name, "work")
+	}
+	name, err = getCmdOutput(other, "git", "config", "user.name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "global" {
+		t.Errorf("got user.name %q outside the included repo, want %q", name, "global")
+	}
+}
+
+func TestGetProblemsCountsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		repo RepoStatus
+		want string
+	}{
+		{"clean", RepoStatus{}, ""},
+		{"status failed", RepoStatus{Deltas: -1}, "error counting changes"},
+		{"rev-list failed", RepoStatus{Unpulled: -1, Unpushed: -1}, "error comparing with upstream"},
+		{"no upstream", RepoStatus{RemoteBranchError: true, Unpulled: -1, Unpushed: -1}, "no upstream"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := strings.Join(getProblems(test.repo), ", ")
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReloadSettingsPicksUpRegistry(t *testing.T) {
+	previousStore, previousRegistered, previousConfig := store, registered, config
+	t.Cleanup(func() {
+		store, registered, config = previousStore, previousRegistered, previousConfig
+	})
+	store = filepath.Join(t.TempDir(), "repos")
+	registered = []string{"/old"}
+
+	err := os.WriteFile(store, []byte("[[repo]]\npath = \"/a\"\n\n[[repo]]\npath = \"/b\"\nalias = \"bee\"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadSettings(newConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(registered, " ") != "/a /b" {
+		t.Errorf("got registered %v, want [/a /b]", registered)
+	}
+	if config.Repos["/b"].Alias != "bee" {
+		t.Errorf("got alias %q for /b, want bee", config.Repos["/b"].Alias)
+	}
+
+	if err := os.WriteFile(store, []byte("[[repo]]\nalias = \"nowhere\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadSettings(newConfig()); err == nil {
+		t.Error("expected an error for a repo without a path")
+	}
+	if strings.Join(registered, " ") != "/a /b" || config.Repos["/b"].Alias != "bee" {
+		t.Errorf("a bad registry replaced the previous one: %v", registered)
+	}
+}
+
+func TestGetModeChanges(t *testing.T) {
+	raw := ":100644 100755 f2ad6c7 0000000 M\x00both\x00" +
+		":100644 100644 6178079 0000000 M\x00plain\x00" +
+		":100644 100755 7898192 0000000 M\x00with space.sh\x00" +
+		":000000 100644 0000000 0000000 U\x00conflict\x00" +
+		"1\t0\tboth\x000\t0\tplain\x000\t0\twith space.sh\x000\t0\tconflict\x00"
+	useFixtures(t, map[string]string{"git diff HEAD --no-renames --raw --numstat -z": raw})
+	if got := getModeChanges("/repo"); got != 1 {
+		t.Errorf("got %d mode changes, want 1", got)
+	}
+}
+
+func TestGetModeChangesStaged(t *testing.T) {
+	repo := initRepo(t)
+	for _, name := range []string{"staged.sh", "unstaged.sh", "edited.sh"} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte("echo\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitIn(t, repo, "add", ".")
+	commitIn(t, repo, "scripts")
+	for _, name := range []string{"staged.sh", "unstaged.sh", "edited.sh"} {
+		if err := os.Chmod(filepath.Join(repo, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitIn(t, repo, "add", "staged.sh", "edited.sh")
+	if err := os.WriteFile(filepath.Join(repo, "edited.sh"), []byte("echo edited\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := getModeChanges(repo); got != 2 {
+		t.Errorf("got %d mode changes, want the staged and unstaged ones", got)
+	}
+}
+
+func TestTranslatePlurals(t *testing.T) {
+	previousConfig := config
+	t.Cleanup(func() {
+		config = previousConfig
+		setLanguage()
+	})
+	config = newConfig()
+	tests := []struct {
+		locale string
+		count  int
+		want   string
+	}{
+		{"en", 1, "1 ref missing"},
+		{"en", 1200, "1,200 refs missing"},
+		{"de_DE.UTF-8", 1, "1 Ref fehlt"},
+		{"de_DE.UTF-8", 2, "2 Refs fehlen"},
+		{"fr_FR.UTF-8", 2, "2 refs missing"},
+	}
+	for _, test := range tests {
+		config.Report.Locale = test.locale
+		setLanguage()
+		got := trn("{{.Count}} ref missing", "{{.Count}} refs missing", test.count)
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.locale, got, test.want)
+		}
+	}
+	config.Report.Locale = "de"
+	setLanguage()
+	if got := tr("snoozed until %s", "1.2."); got != "pausiert bis 1.2." {
+		t.Errorf("got %q, want a German message", got)
+	}
+}
+
+func TestFindRegisteredUsesCachedNames(t *testing.T) {
+	fake := useFixtures(t, map[string]string{
+		"git remote":                         "origin",
+		"git config --get remote.origin.url": "git@example.com:team/beta.git",
+	})
+	previousRegistered, previousState, previousLoaded := registered, state, stateLoaded
+	t.Cleanup(func() {
+		registered, state, stateLoaded = previousRegistered, previousState, previousLoaded
+	})
+	var repos []string
+	for _, name := range []string{"a", "b"} {
+		repo := filepath.Join(t.TempDir(), name)
+		if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repo, ".git", "config"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		repos = append(repos, repo)
+	}
+	registered = repos
+	info, err := os.Stat(filepath.Join(repos[0], ".git", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state = State{Names: map[string]CachedName{repos[0]: {Name: "alpha", ConfigMtime: info.ModTime()}}}
+	stateLoaded = true
+
+	if got := findRegistered("alpha"); got != repos[0] {
+		t.Errorf("got %q for alpha, want %q", got, repos[0])
+	}
+	if got := findRegistered("beta"); got != repos[1] {
+		t.Errorf("got %q for beta, want %q", got, repos[1])
+	}
+	if got := findRegistered("gamma"); got != "" {
+		t.Errorf("got %q for gamma, want none", got)
+	}
+	for _, command := range fake.Ran {
+		if strings.HasPrefix(command, "git status") || strings.HasPrefix(command, "git rev-list") {
+			t.Errorf("checked a status to find a name: %s", command)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// printMatrix shows every local branch of the named repos against its
+// upstream and push target, with ahead and behind counts for each
+func printMatrix(names []string) {
+	if len(names) == 0 {
+		printUsage()
+		return
+	}
+	for i, name := range names {
+		if i > 0 {
+			fmt.Println()
+		}
+		path := findRegistered(name)
+		if path == "" {
+			fmt.Println(name, "is not registered")
+			continue
+		}
+		if !(gitBackend{}).Detect(path) {
+			fmt.Println(path, "is not a git repo")
+			continue
+		}
+		raw, err := getCmdOutput(path, "git", "for-each-ref", "--format=%(refname:short)\t%(upstream:short)\t%(push:short)\t%(HEAD).", "refs/heads")
+		if err != nil {
+			fmt.Println("error listing branches:", err.Error())
+			continue
+		}
+		rows := [][]string{{"", "branch", "upstream", "↑", "↓", "push", "↑", "↓"}}
+		for _, line := range strings.Split(raw, "\n") {
+			fields := strings.Split(line, "\t")
+			if len(fields) != 4 {
+				continue
+			}
+			// The trailing dot keeps output trimming away from the columns
+			branch, upstream, push := fields[0], fields[1], fields[2]
+			row := []string{strings.TrimSpace(strings.TrimSuffix(fields[3], ".")), branch}
+			row = append(row, matrixCells(path, branch, upstream)...)
+			if push == upstream {
+				push = ""
+			}
+			row = append(row, matrixCells(path, branch, push)...)
+			rows = append(rows, row)
+		}
+		fmt.Println(path)
+		printRows(rows)
+	}
+}
+
+// matrixCells is a target with how far branch is ahead of and behind it
+func matrixCells(repo string, branch string, target string) []string {
+	if target == "" {
+		return []string{"-", "", ""}
+	}
+	raw, err := getCmdOutput(repo, "git", "rev-list", "--left-right", "--count", target+"..."+branch)
+	counts := strings.Fields(raw)
+	if err != nil || len(counts) != 2 {
+		return []string{target, "?", "?"}
+	}
+	return []string{target, counts[1], counts[0]}
+}
+
+func printRows(rows [][]string) {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for _, row := range rows {
+		var cells []string
+		for i, cell := range row {
+			if _, err := strconv.Atoi(cell); err == nil {
+				cells = append(cells, strings.Repeat(" ", widths[i]-len(cell))+cell)
+			} else {
+				cells = append(cells, padRight(cell, widths[i]))
+			}
+		}
+		fmt.Println(strings.TrimRight(strings.Join(cells, "  "), " "))
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// mergeReports combines JSON reports from several machines into a single
+// view keyed by host. When listening, other machines can push their reports
+// with a json output pointed at this server.
+func mergeReports(files []string, listen string) {
+	reports := map[string]Report{}
+	for _, file := range files {
+		report, err := loadReport(file)
+		if err != nil {
+			fmt.Println("error reading report:", err.Error())
+			os.Exit(1)
+		}
+		reports[report.Host] = report
+	}
+	if listen == "" {
+		if len(files) == 0 {
+			printUsage()
+			return
+		}
+		printMerged(os.Stdout, reports)
+		return
+	}
+
+	server := &mergeServer{reports: reports, dir: filepath.Join(stateDir, "hosts")}
+	go server.loadSaved()
+	token := func() string {
+		if env := os.Getenv("GIT_STATUS_TOKEN"); env != "" {
+			return env
+		}
+		server.lock.Lock()
+		defer server.lock.Unlock()
+		return config.Server.Token
+	}
+	go watchConfig(&server.lock, server.publishLocal)
+	httpServer := &http.Server{Addr: listen, Handler: requireAuth(server.handler(), token, config.Server.ClientCA != "")}
+	if config.Server.ClientCA != "" {
+		pool, err := loadCertPool(config.Server.ClientCA)
+		if err != nil {
+			fmt.Println("error loading client CA:", err.Error())
+			os.Exit(1)
+		}
+		// Health checks come without a certificate, requireAuth asks for
+		// one everywhere else
+		httpServer.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	}
+	if token() == "" && config.Server.ClientCA == "" {
+		fmt.Println("warning: anyone who can reach", listen, "can read and push reports, see server.token")
+	}
+
+	fmt.Println("accepting reports on", listen)
+	var err error
+	if config.Server.TLSCert != "" {
+		err = httpServer.ListenAndServeTLS(config.Server.TLSCert, config.Server.TLSKey)
+	} else if httpServer.TLSConfig != nil {
+		err = fmt.Errorf("server.client_ca needs server.tls_cert and server.tls_key")
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil {
+		fmt.Println("error serving reports:", err.Error())
+		os.Exit(1)
+	}
+}
+
+// maxReportSize bounds a pushed report, well above what thousands of repos
+// take
+const maxReportSize = 16 << 20
+
+// mergeServer holds the reports a listening merge serves, by host. lock
+// also guards the config and registry, which are reloaded while serving.
+type mergeServer struct {
+	lock    sync.Mutex
+	reports map[string]Report
+	ready   int32
+	// dir keeps pushed reports so a restart doesn't lose them
+	dir string
+	// local is the host of this machine's own report, once it has one
+	local string
+}
+
+// loadSaved reads the reports kept in dir. It runs in the background and
+// /readyz answers once it is done.
+func (server *mergeServer) loadSaved() {
+	defer reportPanic()
+	saved, _ := filepath.Glob(filepath.Join(server.dir, "*.json"))
+	for _, file := range saved {
+		report, err := loadReport(file)
+		if err != nil {
+			continue
+		}
+		server.lock.Lock()
+		if _, ok := server.reports[report.Host]; !ok {
+			server.reports[report.Host] = report
+		}
+		server.lock.Unlock()
+	}
+	atomic.StoreInt32(&server.ready, 1)
+}
+
+// publishLocal checks the repos registered on this machine and shows them
+// as its own host, so the dashboard follows git-status add and delete
+// without a restart. A machine with nothing registered only shows what is
+// pushed to it. It runs where the registry is reloaded, so nothing changes
+// the registry while it is read.
+func (server *mergeServer) publishLocal() {
+	active := 0
+	for _, path := range registered {
+		if path != "" && !strings.HasPrefix(path, commentIndicator) {
+			active++
+		}
+	}
+	var report Report
+	if active != 0 {
+		report = newReport(collectStatuses())
+	}
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.local != "" {
+		delete(server.reports, server.local)
+		server.local = ""
+	}
+	if active != 0 {
+		server.reports[report.Host] = report
+		server.local = report.Host
+	}
+}
+
+// refresh checks only the named repos of this machine and republishes them
+// in its report, what git-status refresh does for the snapshot. The lock is
+// held throughout since the registry and config may be reloaded meanwhile.
+func (server *mergeServer) refresh(names []string) ([]RepoStatus, error) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	selected, err := selectRepos(names)
+	if err != nil {
+		return nil, err
+	}
+	refreshed := checkRepos(selected)
+	report, ok := server.reports[server.local]
+	if !ok {
+		report = newReport(nil)
+		server.local = report.Host
+	}
+	report.Repos = mergeStatuses(report.Repos, refreshed)
+	report.Generated = clock()
+	server.reports[report.Host] = report
+	if refreshed == nil {
+		refreshed = []RepoStatus{}
+	}
+	return refreshed, nil
+}
+
+func (server *mergeServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&server.ready) == 0 {
+			http.Error(w, "loading saved reports", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	if debugEndpoints {
+		registerDebugHandlers(mux)
+		expvar.Publish("hosts", expvar.Func(func() interface{} {
+			server.lock.Lock()
+			defer server.lock.Unlock()
+			return len(server.reports)
+		}))
+	}
+	mux.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var args struct {
+			Repos []string `json:"repos"`
+		}
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReportSize)).Decode(&args)
+		if err != nil || len(args.Repos) == 0 {
+			http.Error(w, "expected {\"repos\": [names or tags]}", http.StatusBadRequest)
+			return
+		}
+		refreshed, err := server.refresh(args.Repos)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(refreshed)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			// Read the report before locking, so a slow or oversized upload
+			// holds up nobody else
+			var report Report
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReportSize)).Decode(&report)
+			if err != nil || report.Host == "" {
+				http.Error(w, "expected a JSON report with a host", http.StatusBadRequest)
+				return
+			}
+			server.lock.Lock()
+			defer server.lock.Unlock()
+			server.reports[report.Host] = report
+			reportsReceived.Add(1)
+			err = writeJSONFile(filepath.Join(server.dir, filepath.Base(report.Host)+".json"), report)
+			if err != nil {
+				fmt.Println("error saving report:", err.Error())
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			server.lock.Lock()
+			reports := make(map[string]Report, len(server.reports))
+			for host, report := range server.reports {
+				reports[host] = report
+			}
+			server.lock.Unlock()
+			if strings.Contains(r.Header.Get("Accept"), "application/json") {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(sortedReports(reports))
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			printMerged(w, reports)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	return mux
+}
+
+// requireAuth checks the bearer token, and a verified client certificate
+// when requireCert is set, on everything but the health checks, which
+// orchestrators call without credentials
+func requireAuth(handler http.Handler, getToken func() string, requireCert bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if requireCert && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			http.Error(w, "a client certificate is required", http.StatusUnauthorized)
+			return
+		}
+		token := getToken()
+		if token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// watchConfig reloads the config and the registry whenever either changes,
+// so the token, how reports are shown and the registered repos can change
+// without a restart. A config or registry with errors is reported and the
+// previous ones kept. TLS settings need a restart. reloaded is called once
+// at the start and again after every reload.
+func watchConfig(lock *sync.Mutex, reloaded func()) {
+	defer reportPanic()
+	watcher := newSettingsWatcher()
+	reloaded()
+	for range time.Tick(2 * time.Second) {
+		changed, err := watcher.reload(lock)
+		if err != nil {
+			fmt.Println("keeping the previous config:", err.Error())
+			continue
+		}
+		if changed {
+			fmt.Println("reloaded", strings.Join(watcher.files, " and "))
+			reloaded()
+		}
+	}
+}
+
+// settingsWatcher notices changes to the config and the registry, for the
+// modes that keep running
+type settingsWatcher struct {
+	files   []string
+	lastMod []time.Time
+}
+
+func newSettingsWatcher() *settingsWatcher {
+	files := []string{configFile}
+	if !isRemoteStore() {
+		files = append(files, store)
+	}
+	return &settingsWatcher{files: files, lastMod: modTimes(files)}
+}
+
+// reload re-reads the config and the registry when either changed since
+// the last call, holding lock while they are swapped, and says whether
+// they were
+func (watcher *settingsWatcher) reload(lock sync.Locker) (bool, error) {
+	mod := modTimes(watcher.files)
+	if equalTimes(mod, watcher.lastMod) {
+		return false, nil
+	}
+	watcher.lastMod = mod
+	loaded, err := readConfig(configFile)
+	if err != nil {
+		return false, err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	err = reloadSettings(loaded)
+	return err == nil, err
+}
+
+// reloadSettings switches to a freshly read config and re-reads the
+// registry over it, the way startup does. Nothing changes on an error.
+func reloadSettings(loaded Config) error {
+	previousConfig, previousOptions := config, storeOptions
+	config, storeOptions = loaded, map[string][]tomlEntry{}
+	applyFlags()
+	paths, err := readRegistered()
+	if err != nil {
+		config, storeOptions = previousConfig, previousOptions
+		return err
+	}
+	registered = paths
+	return nil
+}
+
+// readRegistered reads the registry the way loadRegistered does, returning
+// errors instead of exiting
+func readRegistered() ([]string, error) {
+	raw, err := readStore()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, _, err := parseStore(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", store, err.Error())
+	}
+	err = applyStoreOptions()
+	if err != nil {
+		return nil, err
+	}
+	return registeredPaths(nil, entries), nil
+}
+
+// modTimes are the modification times of files, zero for missing ones
+func modTimes(files []string) []time.Time {
+	times := make([]time.Time, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+	return times
+}
+
+func equalTimes(a []time.Time, b []time.Time) bool {
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+var reportsReceived = expvar.NewInt("reports_received")
+
+// registerDebugHandlers exposes pprof and expvar. They are only added with
+// --debug-endpoints, on this server's own mux rather than the default one.
+func registerDebugHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+}
+
+// loadReport reads a report file. Plain arrays of statuses are accepted
+// too, using the file name as the host.
+func loadReport(file string) (Report, error) {
+	var report Report
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return report, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		err = json.Unmarshal(raw, &report.Repos)
+	} else {
+		err = json.Unmarshal(raw, &report)
+	}
+	if err != nil {
+		return report, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	if report.Host == "" {
+		report.Host = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	return report, nil
+}
+
+func sortedReports(reports map[string]Report) []Report {
+	var sorted []Report
+	for _, report := range reports {
+		sorted = append(sorted, report)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Host < sorted[j].Host
+	})
+	return sorted
+}
+
+func printMerged(w io.Writer, reports map[string]Report) {
+	for i, report := range sortedReports(reports) {
+		if i != 0 {
+			fmt.Fprintln(w)
+		}
+		label := report.Host
+		if report.Title != "" {
+			label = report.Title + " (" + report.Host + ")"
+		}
+		if report.Generated.IsZero() {
+			fmt.Fprintln(w, label)
+		} else {
+			fmt.Fprintln(w, label, report.Generated.Local().Format("2006-01-02 15:04"))
+		}
+		if len(flaggedStatuses(report.Repos)) == 0 && !showAll {
+			fmt.Fprintln(w, "  all clean")
+			continue
+		}
+		printStatuses(w, report.Repos, showAll)
+	}
+}
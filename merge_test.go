@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getMerged(t *testing.T, handler http.Handler) []Report {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Accept", "application/json")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", response.Code, response.Body.String())
+	}
+	var reports []Report
+	if err := json.Unmarshal(response.Body.Bytes(), &reports); err != nil {
+		t.Fatal(err)
+	}
+	return reports
+}
+
+func TestMergeDashboardFollowsRegistry(t *testing.T) {
+	useTempSettings(t)
+	repo := initRepo(t)
+	writeStore(t)
+	server := &mergeServer{reports: map[string]Report{"elsewhere": {Host: "elsewhere"}}, ready: 1}
+	handler := server.handler()
+	watcher := newSettingsWatcher()
+	server.publishLocal()
+	if reports := getMerged(t, handler); len(reports) != 1 || reports[0].Host != "elsewhere" {
+		t.Fatalf("got %+v with nothing registered, want only the pushed report", reports)
+	}
+
+	writeStore(t, repo)
+	if changed, err := watcher.reload(&server.lock); !changed || err != nil {
+		t.Fatalf("registry not reloaded: %v", err)
+	}
+	server.publishLocal()
+	reports := getMerged(t, handler)
+	if len(reports) != 2 {
+		t.Fatalf("got %d reports after add, want 2", len(reports))
+	}
+	local := reports[0]
+	if local.Host == "elsewhere" {
+		local = reports[1]
+	}
+	if len(local.Repos) != 1 || local.Repos[0].Path != repo {
+		t.Errorf("got %+v for this machine, want %s", local.Repos, repo)
+	}
+
+	writeStore(t)
+	if changed, err := watcher.reload(&server.lock); !changed || err != nil {
+		t.Fatalf("registry not reloaded: %v", err)
+	}
+	server.publishLocal()
+	if reports := getMerged(t, handler); len(reports) != 1 || reports[0].Host != "elsewhere" {
+		t.Errorf("got %+v after delete, want only the pushed report", reports)
+	}
+}
+
+func TestMergePost(t *testing.T) {
+	useTempSettings(t)
+	server := &mergeServer{reports: map[string]Report{}, ready: 1, dir: t.TempDir()}
+	handler := server.handler()
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"report", `{"host": "laptop", "repos": []}`, http.StatusNoContent},
+		{"no host", `{"repos": []}`, http.StatusBadRequest},
+		{"not json", `laptop`, http.StatusBadRequest},
+		{"too large", `{"host": "big", "title": "` + strings.Repeat("x", maxReportSize) + `"}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != test.want {
+			t.Errorf("%s: got status %d, want %d", test.name, response.Code, test.want)
+		}
+	}
+	reports := getMerged(t, handler)
+	if len(reports) != 1 || reports[0].Host != "laptop" {
+		t.Errorf("got %+v, want only the laptop report", reports)
+	}
+	if saved, err := loadReport(filepath.Join(server.dir, "laptop.json")); err != nil || saved.Host != "laptop" {
+		t.Errorf("report not saved: %v", err)
+	}
+}
+
+func TestMergeRefresh(t *testing.T) {
+	useTempSettings(t)
+	repo := initRepo(t)
+	writeStore(t, repo)
+	loadRegistered()
+	server := &mergeServer{reports: map[string]Report{}, ready: 1}
+	handler := server.handler()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(body))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+	response := post(`{"repos": ["` + filepath.Base(repo) + `"]}`)
+	var refreshed []RepoStatus
+	if err := json.Unmarshal(response.Body.Bytes(), &refreshed); err != nil || len(refreshed) != 1 || refreshed[0].Path != repo {
+		t.Fatalf("got %d %s", response.Code, response.Body.String())
+	}
+	reports := getMerged(t, handler)
+	if len(reports) != 1 || reports[0].Host != server.local || len(reports[0].Repos) != 1 {
+		t.Errorf("refreshed repo not published: %+v", reports)
+	}
+	if response := post(`{"repos": ["nothing"]}`); response.Code != http.StatusNotFound {
+		t.Errorf("got status %d for an unknown repo", response.Code)
+	}
+	if response := post(`{}`); response.Code != http.StatusBadRequest {
+		t.Errorf("got status %d without repos", response.Code)
+	}
+}
+
+func TestRequireAuthToken(t *testing.T) {
+	handler := requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), func() string { return "secret" }, false)
+	tests := []struct {
+		path  string
+		token string
+		want  int
+	}{
+		{"/healthz", "", http.StatusOK},
+		{"/readyz", "", http.StatusOK},
+		{"/", "", http.StatusUnauthorized},
+		{"/", "wrong", http.StatusUnauthorized},
+		{"/refresh", "", http.StatusUnauthorized},
+		{"/", "secret", http.StatusOK},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.token != "" {
+			request.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != test.want {
+			t.Errorf("%s with %q: got %d, want %d", test.path, test.token, response.Code, test.want)
+		}
+	}
+}
+
+// newTestCert makes a certificate signed by parent, or self-signed when
+// parent is nil
+func newTestCert(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{raw}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestRequireAuthClientCert(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	client := newTestCert(t, "client", &ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewUnstartedServer(requireAuth(mux, func() string { return "" }, true))
+	server.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(path string, certs ...tls.Certificate) int {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		response, err := (&http.Client{Transport: transport}).Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Errorf("health check without a certificate got %d", code)
+	}
+	if code := get("/"); code != http.StatusUnauthorized {
+		t.Errorf("reports without a certificate got %d", code)
+	}
+	if code := get("/", client); code != http.StatusOK {
+		t.Errorf("reports with a certificate got %d", code)
+	}
+}
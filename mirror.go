@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mirrorBackend handles bare clones, typically made with git clone --mirror
+// as backups, and checks that every ref of the source is present
+type mirrorBackend struct{}
+
+func (mirrorBackend) Detect(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	bare, err := getCmdOutput(dir, "git", "rev-parse", "--is-bare-repository")
+	return err == nil && bare == "true"
+}
+
+func (mirrorBackend) Status(repo string) (status RepoStatus) {
+	if isUnsafeRepo(repo) {
+		status.Name = filepath.Base(repo)
+		status.UnsafeOwnership = true
+		return status
+	}
+	status.Name = getRepoName(repo)
+	status.RemoteBranch = getPreferredRemote(repo)
+	if !config.Checks.Remote {
+		return status
+	}
+	if status.RemoteBranch == "" {
+		status.RemoteBranchError = true
+		return status
+	}
+	missing, err := getMissingRefs(repo, status.RemoteBranch)
+	if err != nil {
+		status.RemoteUnreachable = true
+		status.AuthRequired = isAuthError(err)
+		return status
+	}
+	status.MissingRefs = len(missing)
+	return status
+}
+
+func (mirrorBackend) Fetch(repo string) error {
+	_, err := getNetworkCmdOutput(config.Fetch.Timeout, repo, "git", "fetch", "--quiet", "--prune")
+	return err
+}
+
+// getMissingRefs compares the refs on the remote with the local ones and
+// lists those that are absent or point somewhere else
+func getMissingRefs(repo string, remote string) ([]string, error) {
+	raw, err := getNetworkCmdOutput(config.Remote.Timeout, repo, "git", "ls-remote", remote)
+	if err != nil {
+		return nil, err
+	}
+	local, err := getCmdOutput(repo, "git", "for-each-ref", "--format=%(objectname) %(refname)")
+	if err != nil {
+		return nil, err
+	}
+	have := map[string]string{}
+	for _, line := range strings.Split(local, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			have[fields[1]] = fields[0]
+		}
+	}
+
+	var missing []string
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[1] == "HEAD" || strings.HasSuffix(fields[1], "^{}") {
+			continue
+		}
+		if have[fields[1]] != fields[0] {
+			missing = append(missing, fields[1])
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// mountTimeout is how long a network mount gets to answer a stat
+const mountTimeout = 2 * time.Second
+
+// networkFilesystems are mounted from elsewhere and may hang when the
+// server is gone. autofs is listed since its mounts are made on first use.
+var networkFilesystems = []string{
+	"autofs", "nfs", "nfs4", "cifs", "smb3", "smbfs", "9p", "afs", "ceph", "glusterfs",
+	"fuse.sshfs", "fuse.rclone", "davfs",
+}
+
+// isUnavailable is true when path is on a mount that doesn't answer, so it
+// can be reported without blocking on it or mistaking it for a deleted repo
+func isUnavailable(path string) bool {
+	if !contains(networkFilesystems, getFilesystem(path)) {
+		_, err := os.Stat(path)
+		return isMountError(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := os.Stat(path)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return isMountError(err)
+	case <-time.After(mountTimeout):
+		return true
+	}
+}
+
+// isMountError tells a mount that went away from a path that is missing
+func isMountError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EIO, syscall.ESTALE, syscall.ENOTCONN, syscall.EHOSTDOWN, syscall.EHOSTUNREACH, syscall.ETIMEDOUT} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+var mountinfo string
+var mountinfoOnce sync.Once
+
+// getFilesystem finds the type of the deepest mount containing path from
+// /proc/self/mountinfo, or nothing where that isn't available
+func getFilesystem(path string) string {
+	mountinfoOnce.Do(func() {
+		raw, _ := ioutil.ReadFile("/proc/self/mountinfo")
+		mountinfo = string(raw)
+	})
+	deepest := ""
+	fstype := ""
+	for _, line := range strings.Split(mountinfo, "\n") {
+		halves := strings.SplitN(line, " - ", 2)
+		if len(halves) != 2 {
+			continue
+		}
+		fields := strings.Fields(halves[0])
+		source := strings.Fields(halves[1])
+		if len(fields) < 5 || len(source) == 0 {
+			continue
+		}
+		mount := fields[4]
+		if mount != "/" && path != mount && !strings.HasPrefix(path, mount+"/") {
+			continue
+		}
+		if len(mount) >= len(deepest) {
+			deepest = mount
+			fstype = source[0]
+		}
+	}
+	return fstype
+}
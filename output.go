@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+// OutputConfig x
+type OutputConfig struct {
+	Format  string
+	Path    string
+	URL     string
+	Filter  string
+	Token   string
+	TLSCert string
+	TLSKey  string
+	CA      string
+}
+
+func (output OutputConfig) String() string {
+	switch {
+	case output.Path != "":
+		return output.Format + " output to " + output.Path
+	case output.URL != "":
+		return output.Format + " output to " + output.URL
+	}
+	return output.Format + " output"
+}
+
+// writeOutputs sends the statuses to every configured output. Without any
+// configured the table is printed to the terminal.
+func writeOutputs(repos []RepoStatus) {
+	outputs := config.Outputs
+	if len(outputs) == 0 {
+		outputs = []OutputConfig{{Format: "table", Filter: "flagged"}}
+	}
+	for _, output := range outputs {
+		if jsonOutput && output.Path == "" && output.URL == "" {
+			// --json has the terminal to itself
+			continue
+		}
+		err := writeOutput(output, repos)
+		if err != nil {
+			fmt.Println("error writing "+output.String()+":", err.Error())
+		}
+	}
+}
+
+// printJSON writes the statuses of every repo, flagged or not, as a bare
+// array for --json
+func printJSON(w io.Writer, repos []RepoStatus) error {
+	if repos == nil {
+		repos = []RepoStatus{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(repos)
+}
+
+func writeOutput(output OutputConfig, repos []RepoStatus) error {
+	all := showAll || output.Filter == "all"
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	if output.Path == "" && output.URL == "" {
+		w = os.Stdout
+	}
+
+	switch output.Format {
+	case "json":
+		if !all {
+			repos = flaggedStatuses(repos)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(newReport(repos))
+		if err != nil {
+			return err
+		}
+	default:
+		printHeader(w, newReport(repos))
+		if len(groups) != 0 {
+			printGroupedStatuses(w, repos, all)
+		} else {
+			printStatuses(w, repos, all)
+		}
+	}
+
+	switch {
+	case output.Path != "":
+		err := checkPlaintext(output.Path)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(output.Path, buf.Bytes())
+	case output.URL != "":
+		return postOutput(output, buf.Bytes())
+	}
+	return nil
+}
+
+// printHeader labels the table with the title and, when asked for, the host
+// and time of the run so reports from several machines can be told apart
+func printHeader(w io.Writer, report Report) {
+	var header string
+	if config.Report.Header {
+		header = report.Host + " " + report.Generated.Format("2006-01-02 15:04 MST")
+	}
+	switch {
+	case report.Title != "" && header != "":
+		fmt.Fprintf(w, "%s (%s)\n", report.Title, header)
+	case report.Title != "":
+		fmt.Fprintln(w, report.Title)
+	case header != "":
+		fmt.Fprintln(w, header)
+	}
+}
+
+func flaggedStatuses(repos []RepoStatus) []RepoStatus {
+	var flagged []RepoStatus
+	for _, repo := range repos {
+		if repo.ShouldReport {
+			flagged = append(flagged, repo)
+		}
+	}
+	return flagged
+}
+
+func postOutput(output OutputConfig, body []byte) error {
+	contentType := "text/plain; charset=utf-8"
+	if output.Format == "json" {
+		contentType = "application/json"
+	}
+	tlsConfig, err := output.tlsConfig()
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	req, err := http.NewRequest(http.MethodPost, output.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if output.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+output.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// tlsConfig loads the client certificate and CA an output was given, for
+// posting to a merge server that requires them
+func (output OutputConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if output.TLSCert != "" || output.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(output.TLSCert, output.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if output.CA != "" {
+		pool, err := loadCertPool(output.CA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, fmt.Errorf("%s: no certificates found", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// auditPermissions looks for files git will fail on later: ones in .git or
+// at the top of the working tree owned by someone other than checks.owner,
+// the invoking user by default, and a world-writable .git
+func auditPermissions(repo string) string {
+	owner, err := getExpectedOwner()
+	if err != nil {
+		return ""
+	}
+	foreign := 0
+	worldWritable := 0
+	check := func(path string, info os.FileInfo) {
+		if uid, ok := fileOwner(info); ok && uid != owner {
+			foreign++
+		}
+		if info.Mode()&0002 != 0 && info.Mode()&os.ModeSymlink == 0 {
+			worldWritable++
+		}
+	}
+	gitDir := filepath.Join(repo, ".git")
+	filepath.Walk(gitDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil {
+			check(path, info)
+		}
+		return nil
+	})
+	entries, _ := os.ReadDir(repo)
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && entry.Name() != ".git" {
+			if uid, ok := fileOwner(info); ok && uid != owner {
+				foreign++
+			}
+		}
+	}
+
+	var problems []string
+	if foreign > 0 {
+		problems = append(problems, fmt.Sprintf("%d files owned by another user", foreign))
+	}
+	if worldWritable > 0 {
+		problems = append(problems, fmt.Sprintf("%d world-writable in .git", worldWritable))
+	}
+	return strings.Join(problems, ", ")
+}
+
+func getExpectedOwner() (uint32, error) {
+	usr, err := getInvokingUser()
+	if config.Checks.Owner != "" {
+		usr, err = user.Lookup(config.Checks.Owner)
+	}
+	if err != nil {
+		return 0, err
+	}
+	uid, err := strconv.ParseUint(usr.Uid, 10, 32)
+	return uint32(uid), err
+}
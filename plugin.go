@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// plugin is the git-status-<name> executable an unknown command resolved to
+var plugin string
+
+// findPlugin looks for git-status-<name> on PATH, the way git finds
+// git-<name> for commands it doesn't know
+func findPlugin(name string) string {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, `/\.`) {
+		return ""
+	}
+	path, err := exec.LookPath("git-status-" + name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// runPlugin checks the repos like a run with the same flags would and hands
+// the plugin the report, every repo included, as JSON on stdin. Arguments
+// git-status doesn't know, or everything after --, are passed on. The
+// plugin's exit code becomes ours.
+func runPlugin(args []string) {
+	raw, err := json.Marshal(newReport(collectStatuses()))
+	if err != nil {
+		fmt.Println("error encoding report:", err.Error())
+		os.Exit(1)
+	}
+	cmd := exec.Command(plugin, args...)
+	cmd.Stdin = bytes.NewReader(raw)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"GIT_STATUS_STORE="+store,
+		"GIT_STATUS_CONFIG="+configFile,
+		"GIT_STATUS_STATE_DIR="+stateDir,
+	)
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		fmt.Println("error running "+plugin+":", err.Error())
+		os.Exit(1)
+	}
+}
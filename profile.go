@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runProfile parses the command line again with the flags of the named
+// profile in front, so the profile can pick the command and anything given
+// on the command line overrides it
+func runProfile() {
+	if len(operands) == 0 {
+		action = ActionHelp
+		return
+	}
+	name := operands[0]
+	loaded, err := readConfig(configFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(exitConfigError)
+	}
+	profile, ok := loaded.Profiles[name]
+	if !ok {
+		fmt.Println("no profile named", name, "in", configFile)
+		os.Exit(1)
+	}
+
+	var rest []string
+	for i, arg := range os.Args[2:] {
+		if arg == name {
+			rest = append(rest, os.Args[i+3:]...)
+			break
+		}
+		rest = append(rest, arg)
+	}
+	action = ActionNone
+	paths = nil
+	parseArgs(append(strings.Fields(profile), rest...))
+	if action == ActionRun {
+		fmt.Println("profile", name, "can't run another profile")
+		os.Exit(1)
+	}
+}
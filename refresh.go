@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// refreshRepos recomputes only the repos named, directly or by tag, and
+// folds them into the last snapshot and the file and URL outputs so the
+// rest of the set doesn't have to be checked again
+func refreshRepos(names []string) {
+	if len(names) == 0 {
+		printUsage()
+		return
+	}
+	selected, err := selectRepos(names)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	refreshed := checkRepos(selected)
+	printStatuses(os.Stdout, refreshed, true)
+
+	report, err := loadReport(snapshotPath())
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("error reading snapshot:", err.Error())
+	}
+	repos := mergeStatuses(report.Repos, refreshed)
+	for _, output := range config.Outputs {
+		if output.Path == "" && output.URL == "" {
+			continue
+		}
+		err = writeOutput(output, repos)
+		if err != nil {
+			fmt.Println("error writing "+output.String()+":", err.Error())
+		}
+	}
+	if config.Snapshot.Enabled {
+		writeSnapshot(repos)
+	}
+}
+
+// selectRepos finds the registered repos for names and tags
+func selectRepos(names []string) ([]string, error) {
+	var selected []string
+	for _, name := range names {
+		found := taggedPaths(name)
+		if path := findRegistered(name); path != "" {
+			found = append(found, path)
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("%s is neither a registered repo nor a tag", name)
+		}
+		for _, path := range found {
+			if !contains(selected, path) {
+				selected = append(selected, path)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// checkRepos checks paths the way a full run does, commenting out those
+// that are no longer repos
+func checkRepos(paths []string) []RepoStatus {
+	var checked []RepoStatus
+	for _, path := range paths {
+		status, gone := classifyPath(path)
+		if gone != "" {
+			fmt.Println(path, "no longer appears to be a repo, commenting it out")
+			commentPaths([]string{path}, gone)
+			continue
+		}
+		checked = append(checked, status)
+	}
+	saveState()
+	return checked
+}
+
+// taggedPaths lists the registered repos with the given tag
+func taggedPaths(tag string) []string {
+	var paths []string
+	for _, path := range registered {
+		repo, ok := config.Repos[path]
+		if ok && contains(repo.Tags, tag) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// mergeStatuses replaces the statuses of refreshed repos in place, adding
+// those that weren't in the previous run at the end
+func mergeStatuses(previous []RepoStatus, refreshed []RepoStatus) []RepoStatus {
+	merged := append([]RepoStatus{}, previous...)
+	for _, status := range refreshed {
+		replaced := false
+		for i := range merged {
+			if merged[i].Path == status.Path {
+				merged[i] = status
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, status)
+		}
+	}
+	return merged
+}
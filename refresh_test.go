@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckReposCommentsOutGoneRepos(t *testing.T) {
+	dir := useTempSettings(t)
+	repo := initRepo(t)
+	gone := filepath.Join(dir, "gone")
+	writeStore(t, repo, gone)
+	loadRegistered()
+
+	selected, err := selectRepos([]string{filepath.Base(repo), "gone"})
+	if err != nil || !reflect.DeepEqual(selected, []string{repo, gone}) {
+		t.Fatalf("got %v, %v", selected, err)
+	}
+	checked := checkRepos(selected)
+	if len(checked) != 1 || checked[0].Path != repo {
+		t.Errorf("got %+v, want only %s", checked, repo)
+	}
+	raw, err := ioutil.ReadFile(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `missing"`) {
+		t.Errorf("missing repo not commented out:\n%s", raw)
+	}
+	if _, err := selectRepos([]string{"nothing"}); err == nil {
+		t.Error("selected a repo that isn't registered")
+	}
+}
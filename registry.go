@@ -0,0 +1,437 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// storedEntries maps expanded registry paths back to how they are written in
+// the store, so rewriting it keeps entries like $REPOS_ROOT/foo portable
+var storedEntries = map[string]string{}
+
+// expandEntry resolves variables in a registry entry, taking them from the
+// environment first and then from [vars] in the config. Entries using a
+// variable that is set nowhere are returned as they are.
+func expandEntry(entry string) string {
+	if !strings.Contains(entry, "$") || strings.HasPrefix(entry, commentIndicator) {
+		return entry
+	}
+	resolved := true
+	path := os.Expand(entry, func(name string) string {
+		value := lookupVar(name)
+		if value == "" {
+			resolved = false
+			return "$" + name
+		}
+		return value
+	})
+	if !resolved {
+		return entry
+	}
+	path = filepath.Clean(expandHome(path))
+	storedEntries[path] = entry
+	return path
+}
+
+func lookupVar(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return filepath.Clean(expandHome(value))
+	}
+	return config.Vars[name]
+}
+
+func storedEntry(path string) string {
+	if entry, ok := storedEntries[path]; ok {
+		return entry
+	}
+	return path
+}
+
+// contractEntry writes a new path relative to the longest matching variable
+// from [vars], so the store can be shared between machines
+func contractEntry(path string) string {
+	var names []string
+	for name := range config.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best := ""
+	bestRoot := ""
+	for _, name := range names {
+		root := lookupVar(name)
+		if root == "" || len(root) <= len(bestRoot) {
+			continue
+		}
+		if strings.HasPrefix(path, root+string(filepath.Separator)) {
+			best = name
+			bestRoot = root
+		}
+	}
+	if best == "" {
+		return path
+	}
+	entry := "$" + best + path[len(bestRoot):]
+	storedEntries[path] = entry
+	return entry
+}
+
+// updateStore rewrites the store under a lock. It is read again once the
+// lock is held, so concurrent adds from a provisioning script each see the
+// other's entries instead of overwriting them.
+func updateStore(update func(entries []string) []string) {
+	if isRemoteStore() {
+		fmt.Println("error: the registry at", store, "is read-only")
+		os.Exit(1)
+	}
+	unlock, err := lockStore()
+	if err != nil {
+		fmt.Println("error locking registry:", err.Error())
+		os.Exit(1)
+	}
+	defer unlock()
+
+	registered = nil
+	loadRegistered()
+	migrating := legacyStore
+	if migrating {
+		err = keepLegacyStore()
+		if err != nil {
+			fmt.Println("error keeping the old registry:", err.Error())
+			os.Exit(1)
+		}
+	}
+	registered = update(registered)
+
+	var lines []string
+	for _, path := range registered {
+		if path != "" {
+			lines = append(lines, storedEntry(path))
+		}
+	}
+	data, err := encryptStore(formatStore(lines))
+	if err == nil {
+		err = writeFileAtomic(store, data)
+	}
+	if err != nil {
+		fmt.Println("error saving paths:", err.Error())
+		fmt.Println("dumping lines:")
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		return
+	}
+	if migrating {
+		legacyStore = false
+		fmt.Fprintf(os.Stderr, "migrated %s to TOML, the old one is kept as %s.legacy\n", store, store)
+	}
+}
+
+// storeEntry is a registry entry as the rest of git-status sees it, a path
+// or a commented out line like the old format had, and its line in the store
+type storeEntry struct {
+	Text string
+	Line int
+}
+
+// storeOptions are the repo settings kept in the store's [[repo]] tables,
+// by path, so rewriting the store keeps them
+var storeOptions = map[string][]tomlEntry{}
+
+// setStoreOption sets a key in a repo's [[repo]] table, for updateStore to
+// write
+func setStoreOption(path string, key string, value interface{}) {
+	options := storeOptions[path]
+	for i, option := range options {
+		if len(option.Key) == 1 && option.Key[0] == key {
+			options[i].Value = tomlValue(value)
+			return
+		}
+	}
+	storeOptions[path] = append(options, tomlEntry{Table: []string{"repo"}, Key: []string{key}, Value: tomlValue(value)})
+}
+
+// legacyStore is set when the store was read in the old format, one path
+// per line, so main can migrate it
+var legacyStore bool
+
+// parseStore reads the registry. It is TOML, a [[repo]] table for each
+// repo with its path, commented_out when it was commented out, and any key
+// a [repo] table in the config takes. The old format, one path per line
+// and # for commented out ones, is still read and reported as legacy.
+func parseStore(raw []byte) (entries []storeEntry, legacy bool, err error) {
+	text := strings.Replace(string(raw), "\r\n", "\n", -1)
+	structured := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "[[repo]]" {
+			structured = true
+		}
+	}
+	if !structured {
+		for i, line := range strings.Split(text, "\n") {
+			entries = append(entries, storeEntry{Text: strings.TrimSpace(line), Line: i + 1})
+			legacy = legacy || strings.TrimSpace(line) != ""
+		}
+		return entries, legacy, nil
+	}
+
+	parsed, err := parseToml(text)
+	if err != nil {
+		return nil, false, err
+	}
+	// Comment lines are kept as entries, so rewriting the store keeps them
+	var comments []storeEntry
+	for i, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, commentIndicator) {
+			comments = append(comments, storeEntry{Text: line, Line: i + 1})
+		}
+	}
+	type repo struct {
+		path      string
+		commented interface{}
+		line      int
+		options   []tomlEntry
+	}
+	var repos []*repo
+	for _, entry := range parsed {
+		if len(entry.Table) != 1 || entry.Table[0] != "repo" || entry.Index < 0 {
+			return nil, false, fmt.Errorf("%d: %s: only [[repo]] tables belong in the registry", entry.Line, entry.Name())
+		}
+		for len(repos) <= entry.Index {
+			repos = append(repos, &repo{})
+		}
+		current := repos[entry.Index]
+		switch strings.Join(entry.Key, ".") {
+		case "path":
+			current.path, err = tomlString(entry.Value)
+			current.line = entry.Line
+		case "commented_out":
+			current.commented, err = tomlString(entry.Value)
+		default:
+			current.options = append(current.options, entry)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("%d: %s: %s", entry.Line, entry.Name(), err.Error())
+		}
+	}
+	for i, current := range repos {
+		if current.path == "" {
+			return nil, false, fmt.Errorf("repo %d has no path", i+1)
+		}
+		text := current.path
+		if reason, ok := current.commented.(string); ok {
+			text = commentIndicator + " " + current.path
+			if reason != "" {
+				text = commentIndicator + " " + reason + ": " + current.path
+			}
+		}
+		if len(current.options) != 0 {
+			storeOptions[expandEntry(current.path)] = current.options
+		}
+		entries = append(entries, storeEntry{Text: text, Line: current.line})
+	}
+	entries = append(entries, comments...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Line < entries[j].Line })
+	return entries, false, nil
+}
+
+// applyStoreOptions applies the settings from the store's [[repo]] tables
+// over the config's [repo] tables
+func applyStoreOptions() error {
+	var errs ConfigErrors
+	for path, options := range storeOptions {
+		if strings.Contains(path, "$") {
+			continue
+		}
+		for _, option := range options {
+			entry := option
+			entry.Table = []string{"repo", path}
+			err := config.apply(entry)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s:%d: %s: %s", store, option.Line, strings.Join(option.Key, "."), err.Error()))
+			}
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// formatStore writes registry entries as the TOML parseStore reads
+func formatStore(entries []string) []byte {
+	var lines []string
+	for _, entry := range entries {
+		if isFreeComment(entry) {
+			if len(lines) != 0 && !strings.HasPrefix(lines[len(lines)-1], commentIndicator) {
+				lines = append(lines, "")
+			}
+			lines = append(lines, entry)
+			continue
+		}
+		path := entry
+		reason := ""
+		commented := strings.HasPrefix(entry, commentIndicator)
+		if commented {
+			_, _, path = parseComment(entry)
+			rest := strings.TrimSpace(strings.TrimPrefix(entry, commentIndicator))
+			reason = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(rest, path), ": "))
+		}
+		if len(lines) != 0 && !strings.HasPrefix(lines[len(lines)-1], commentIndicator) {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "[[repo]]", "path = "+tomlEncode(path))
+		if commented {
+			lines = append(lines, "commented_out = "+tomlEncode(reason))
+		}
+		for _, option := range storeOptions[expandEntry(path)] {
+			lines = append(lines, tomlKey(option.Key)+" = "+tomlEncode(option.Value))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// keepLegacyStore copies a store in the old format next to it before it is
+// first rewritten as TOML. Only commands that change the registry get that
+// far, so read-only ones keep working on a store they can't write.
+func keepLegacyStore() error {
+	raw, err := ioutil.ReadFile(store)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store+".legacy", raw)
+}
+
+// isFreeComment tells a comment line from the old format, or one written in
+// the store, from a commented out repo
+func isFreeComment(entry string) bool {
+	if !strings.HasPrefix(entry, commentIndicator) {
+		return false
+	}
+	_, _, path := parseComment(entry)
+	return !filepath.IsAbs(path) && !strings.HasPrefix(path, "/") &&
+		!strings.HasPrefix(path, "~") && !strings.HasPrefix(path, "$")
+}
+
+// lockStore takes a lock file next to the store. A lock left behind by a
+// process that died is taken over once it is older than a minute.
+func lockStore() (unlock func(), err error) {
+	lock := store + ".lock"
+	err = os.MkdirAll(filepath.Dir(lock), 0755)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, permissions)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(lock); statErr == nil && time.Since(info.ModTime()) > time.Minute {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is held by another git-status", lock)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// parseComment splits a commented out entry into the date and reason it was
+// commented out, when those were recorded, and its path
+func parseComment(line string) (date time.Time, reason string, path string) {
+	rest := strings.TrimSpace(strings.TrimPrefix(line, commentIndicator))
+	if len(rest) >= 10 {
+		if parsed, err := time.ParseInLocation("2006-01-02", rest[:10], time.Local); err == nil {
+			date = parsed
+			rest = strings.TrimSpace(rest[10:])
+		}
+	}
+	if i := strings.Index(rest, ": "); i >= 0 {
+		reason = rest[:i]
+		rest = rest[i+2:]
+	}
+	return date, reason, rest
+}
+
+// tidyStore sorts the registry, removes duplicates and normalizes paths.
+// Commented out entries are dropped once older than --older-than, or when
+// they carry no date and their path is no longer a repo.
+func tidyStore() {
+	tidy := func(entries []string) []string {
+		var active []string
+		var comments []string
+		for _, entry := range entries {
+			if entry == "" || strings.HasPrefix(entry, commentIndicator) {
+				continue
+			}
+			if !strings.Contains(storedEntry(entry), "$") {
+				entry = filepath.Clean(expandHome(entry))
+			}
+			if !contains(active, entry) {
+				active = append(active, entry)
+			}
+		}
+		cutoff := time.Now().Add(-olderThan)
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry, commentIndicator) || contains(comments, entry) {
+				continue
+			}
+			date, _, path := parseComment(entry)
+			path = expandEntry(path)
+			if contains(active, path) {
+				continue
+			}
+			if !date.IsZero() && date.Before(cutoff) || date.IsZero() && !isRepo(path) {
+				continue
+			}
+			comments = append(comments, entry)
+		}
+		sort.SliceStable(active, func(i, j int) bool {
+			return naturalLess(active[i], active[j], ignoreCase)
+		})
+		sort.SliceStable(comments, func(i, j int) bool {
+			_, _, a := parseComment(comments[i])
+			_, _, b := parseComment(comments[j])
+			return naturalLess(a, b, ignoreCase)
+		})
+		return append(active, comments...)
+	}
+
+	if dryRun {
+		for _, entry := range tidy(registered) {
+			fmt.Println(storedEntry(entry))
+		}
+		return
+	}
+	before := len(registered)
+	var after int
+	updateStore(func(entries []string) []string {
+		before = 0
+		raw, _ := readStore()
+		stored, _, _ := parseStore(raw)
+		for _, entry := range stored {
+			if entry.Text != "" {
+				before++
+			}
+		}
+		entries = tidy(entries)
+		after = len(entries)
+		return entries
+	})
+	fmt.Printf("%d entries kept, %d removed\n", after, before-after)
+}
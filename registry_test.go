@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLegacyStoreMigratesOnWrite(t *testing.T) {
+	useTempSettings(t)
+	legacy := "# my repos\n/src/app\n# gone: /src/old\n"
+	if err := ioutil.WriteFile(store, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	previousLegacy := legacyStore
+	t.Cleanup(func() { legacyStore = previousLegacy })
+
+	loadRegistered()
+	if !legacyStore {
+		t.Fatal("old format not detected")
+	}
+	if _, err := os.Stat(store + ".legacy"); !os.IsNotExist(err) {
+		t.Error("reading the registry migrated it")
+	}
+	want := []string{"# my repos", "/src/app", "# gone: /src/old"}
+	if !reflect.DeepEqual(registered, want) {
+		t.Errorf("got %q, want %q", registered, want)
+	}
+
+	updateStore(func(entries []string) []string { return append(entries, "/src/new") })
+	if kept, err := ioutil.ReadFile(store + ".legacy"); err != nil || string(kept) != legacy {
+		t.Errorf("old registry not kept: %q, %v", kept, err)
+	}
+	raw, err := ioutil.ReadFile(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(raw), "# my repos\n[[repo]]\n") {
+		t.Errorf("comment not kept as a TOML comment:\n%s", raw)
+	}
+	entries, isLegacy, err := parseStore(raw)
+	if err != nil || isLegacy {
+		t.Fatalf("migrated store unreadable: %v", err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Text)
+	}
+	want = append(want, "/src/new")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q after migrating, want %q", got, want)
+	}
+}
+
+func TestIsFreeComment(t *testing.T) {
+	tests := map[string]bool{
+		"# my repos":                   true,
+		"#":                            true,
+		"# gone: /src/old":             false,
+		"# 2024-01-01 gone: ~/src/old": false,
+		"# $REPOS/app":                 false,
+		"/src/app":                     false,
+	}
+	for entry, want := range tests {
+		if got := isFreeComment(entry); got != want {
+			t.Errorf("%q: got %t, want %t", entry, got, want)
+		}
+	}
+}
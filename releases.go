@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReleaseDrift is how far a repo's default branch has moved past its
+// latest tag
+type ReleaseDrift struct {
+	Name    string
+	Branch  string
+	Tag     string
+	Tagged  time.Time
+	Commits int
+	Hosted  string
+}
+
+// listReleases prints the repos whose default branch has commits that are
+// not in a tag older than --older-than. With --hosted the tag is also
+// compared with the latest GitHub release, which can lag behind tags.
+func listReleases(hosted bool) {
+	found := false
+	for _, path := range registered {
+		if len(path) == 0 || strings.HasPrefix(path, commentIndicator) {
+			continue
+		}
+		if isArchived(path) && !includeArchived || !(gitBackend{}).Detect(path) || isUnsafeRepo(path) {
+			continue
+		}
+		drift, ok := getReleaseDrift(path)
+		if !ok {
+			continue
+		}
+		if hosted {
+			drift.Hosted = getHostedRelease(path)
+		}
+		unreleased := drift.Hosted != "" && drift.Hosted != drift.Tag
+		if !unreleased && (drift.Commits == 0 || clock().Sub(drift.Tagged) < olderThan) {
+			continue
+		}
+		found = true
+		fmt.Printf("%s (%s) %s+%d, tagged %s ago", drift.Name, drift.Branch, drift.Tag, drift.Commits, formatAge(clock().Sub(drift.Tagged)))
+		if unreleased {
+			fmt.Printf(", latest release is %s", drift.Hosted)
+		}
+		fmt.Println()
+	}
+	if !found {
+		fmt.Println("No repos are overdue for a release")
+	}
+}
+
+// getReleaseDrift compares the tip of the default branch with the newest
+// tag reachable from it. Repos that were never tagged don't do releases.
+func getReleaseDrift(repo string) (drift ReleaseDrift, ok bool) {
+	drift.Name = getCachedRepoName(repo)
+	drift.Branch = getDefaultBranch(repo)
+	if drift.Branch == "" {
+		return drift, false
+	}
+	tag, err := getCmdOutput(repo, "git", "describe", "--tags", "--abbrev=0", drift.Branch)
+	if err != nil {
+		return drift, false
+	}
+	drift.Tag = tag
+	drift.Tagged = getCommitTime(repo, tag)
+	raw, err := getCmdOutput(repo, "git", "rev-list", "--count", tag+".."+drift.Branch)
+	if err != nil {
+		return drift, false
+	}
+	drift.Commits, _ = strconv.Atoi(raw)
+	return drift, true
+}
+
+// getHostedRelease asks GitHub for the latest release of repos hosted
+// there, using GITHUB_TOKEN when set to avoid the anonymous rate limit
+func getHostedRelease(repo string) string {
+	url, _ := getCmdOutput(repo, "git", "config", "--get", "remote."+getUpstreamRemote(repo)+".url")
+	i := strings.Index(url, "github.com")
+	if i == -1 {
+		return ""
+	}
+	slug := strings.TrimSuffix(strings.TrimSuffix(url[i+len("github.com")+1:], "/"), ".git")
+
+	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/repos/"+slug+"/releases/latest", nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := http.Client{Timeout: config.Remote.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("error getting release of", slug+":", err.Error())
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	var latest struct {
+		TagName string `json:"tag_name"`
+	}
+	json.NewDecoder(resp.Body).Decode(&latest)
+	return latest.TagName
+}
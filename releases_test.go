@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestGetReleaseDrift(t *testing.T) {
+	useTempSettings(t)
+	repo := initRepo(t)
+	if _, ok := getReleaseDrift(repo); ok {
+		t.Error("a repo without tags has a release")
+	}
+	gitIn(t, repo, "tag", "v1.0")
+	commitIn(t, repo, "feature")
+	commitIn(t, repo, "fix")
+	drift, ok := getReleaseDrift(repo)
+	if !ok || drift.Tag != "v1.0" || drift.Commits != 2 || drift.Branch != gitIn(t, repo, "symbolic-ref", "--short", "HEAD") {
+		t.Errorf("got %+v, %t, want 2 commits past v1.0", drift, ok)
+	}
+	if drift.Tagged.IsZero() {
+		t.Error("no tag time")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isRemoteStore is true when --store points at a URL, such as a list of
+// repos a team maintains centrally. Those registries are read-only.
+func isRemoteStore() bool {
+	return strings.HasPrefix(store, "https://")
+}
+
+// fetchStore downloads a remote registry, keeping a copy in the state dir.
+// The copy's ETag makes unchanged lists cheap to check, and the copy is used
+// as is when the server can't be reached.
+func fetchStore() ([]byte, error) {
+	cache := filepath.Join(stateDir, "stores", fmt.Sprintf("%x", sha1.Sum([]byte(store))))
+	cached, cacheErr := ioutil.ReadFile(cache)
+
+	raw, etag, err := getStore(cache, cacheErr == nil)
+	if err != nil {
+		if cacheErr != nil {
+			return nil, err
+		}
+		fmt.Println("using the cached registry:", err.Error())
+		return cached, nil
+	}
+	if raw == nil {
+		return cached, nil
+	}
+	err = writeFileAtomic(cache, raw)
+	if err == nil {
+		err = writeFileAtomic(cache+".etag", []byte(etag))
+	}
+	if err != nil {
+		fmt.Println("error caching registry:", err.Error())
+	}
+	return raw, nil
+}
+
+// getStore fetches the registry, returning nil content when the server says
+// the cached copy is still current
+func getStore(cache string, haveCache bool) (raw []byte, etag string, err error) {
+	req, err := http.NewRequest(http.MethodGet, store, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if haveCache {
+		if etag, err := ioutil.ReadFile(cache + ".etag"); err == nil && len(etag) != 0 {
+			req.Header.Set("If-None-Match", string(etag))
+		}
+	}
+	client := http.Client{Timeout: config.Remote.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && haveCache:
+		return nil, "", nil
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, "", os.ErrNotExist
+	case resp.StatusCode != http.StatusOK:
+		return nil, "", fmt.Errorf("%s answered %s", store, resp.Status)
+	}
+	raw, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return raw, resp.Header.Get("ETag"), nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rpcRequest is a JSON-RPC 2.0 request or notification
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcServer answers JSON-RPC over stdio, framed with Content-Length headers
+// the way language servers are, so editor plugins can reuse their clients
+type rpcServer struct {
+	out       io.Writer
+	writeLock sync.Mutex
+	stop      chan struct{}
+	// settings guards the config and registry, reloaded when they change
+	// so list and status follow git-status add and delete
+	settings   sync.RWMutex
+	reloadLock sync.Mutex
+	watcher    *settingsWatcher
+}
+
+// runRPC serves until stdin closes or exit is called. Methods:
+//
+//	status      {"paths": [...]} optional, returns the statuses
+//	list        returns the registered paths
+//	subscribe   {"interval": seconds}, sends a "statusChanged" notification
+//	            with the repos whose status changed, checking on that interval
+//	unsubscribe stops the notifications
+//	shutdown, exit
+func runRPC() {
+	// Anything else printed would corrupt the stream, so it goes to stderr
+	server := &rpcServer{out: os.Stdout, watcher: newSettingsWatcher()}
+	os.Stdout = os.Stderr
+
+	reader := textproto.NewReader(bufio.NewReader(os.Stdin))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			fmt.Println("error reading request: missing Content-Length")
+			return
+		}
+		body := make([]byte, length)
+		_, err = io.ReadFull(reader.R, body)
+		if err != nil {
+			return
+		}
+		var request rpcRequest
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			server.send(map[string]interface{}{"jsonrpc": "2.0", "id": nil,
+				"error": rpcError{Code: -32700, Message: err.Error()}})
+			continue
+		}
+		if request.Method == "exit" {
+			return
+		}
+		go server.handle(request)
+	}
+}
+
+func (server *rpcServer) handle(request rpcRequest) {
+	defer reportPanic()
+	result, err := server.call(request.Method, request.Params)
+	if request.ID == nil {
+		return
+	}
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	if err != nil {
+		response["error"] = err
+	} else {
+		response["result"] = result
+	}
+	server.send(response)
+}
+
+// current reloads the config and the registry if either changed and
+// returns holding them for reading, to be released with RUnlock
+func (server *rpcServer) current() {
+	server.reloadLock.Lock()
+	_, err := server.watcher.reload(&server.settings)
+	server.reloadLock.Unlock()
+	if err != nil {
+		fmt.Println("keeping the previous config:", err.Error())
+	}
+	server.settings.RLock()
+}
+
+func (server *rpcServer) call(method string, params json.RawMessage) (interface{}, *rpcError) {
+	switch method {
+	case "status", "list":
+		server.current()
+		defer server.settings.RUnlock()
+	}
+	switch method {
+	case "status":
+		var args struct {
+			Paths []string `json:"paths"`
+		}
+		if len(params) != 0 && json.Unmarshal(params, &args) != nil {
+			return nil, &rpcError{Code: -32602, Message: "expected {\"paths\": [...]}"}
+		}
+		return rpcStatuses(args.Paths), nil
+	case "list":
+		var active []string
+		for _, path := range registered {
+			if path != "" && !strings.HasPrefix(path, commentIndicator) {
+				active = append(active, path)
+			}
+		}
+		return active, nil
+	case "subscribe":
+		args := struct {
+			Interval float64 `json:"interval"`
+		}{Interval: 60}
+		if len(params) != 0 && json.Unmarshal(params, &args) != nil || args.Interval <= 0 {
+			return nil, &rpcError{Code: -32602, Message: "expected {\"interval\": seconds}"}
+		}
+		stop := make(chan struct{})
+		server.unsubscribe(stop)
+		go server.watch(time.Duration(args.Interval*float64(time.Second)), stop)
+		return true, nil
+	case "unsubscribe":
+		server.unsubscribe(nil)
+		return true, nil
+	case "shutdown":
+		server.unsubscribe(nil)
+		return nil, nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "unknown method " + method}
+}
+
+// unsubscribe stops the notifications, handing over to next, the stop
+// channel of a new subscription, in the same step so that two subscribes at
+// once leave only one watcher running
+func (server *rpcServer) unsubscribe(next chan struct{}) {
+	server.writeLock.Lock()
+	defer server.writeLock.Unlock()
+	if server.stop != nil {
+		close(server.stop)
+	}
+	server.stop = next
+}
+
+// watch notifies about repos whose status differs from the previous check
+func (server *rpcServer) watch(interval time.Duration, stop chan struct{}) {
+	defer reportPanic()
+	previous := map[string]RepoStatus{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var changed []RepoStatus
+		server.current()
+		statuses := rpcStatuses(nil)
+		server.settings.RUnlock()
+		for _, status := range statuses {
+			if !reflect.DeepEqual(previous[status.Path], status) {
+				changed = append(changed, status)
+			}
+			previous[status.Path] = status
+		}
+		if len(changed) != 0 {
+			server.send(map[string]interface{}{"jsonrpc": "2.0", "method": "statusChanged", "params": changed})
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func rpcStatuses(paths []string) []RepoStatus {
+	statuses := []RepoStatus{}
+	if len(paths) == 0 {
+		for _, path := range registered {
+			if path != "" && !strings.HasPrefix(path, commentIndicator) && (!isArchived(path) || includeArchived) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	for _, path := range paths {
+		if isRepo(path) {
+			statuses = append(statuses, getStatus(path))
+		}
+	}
+	saveState()
+	return statuses
+}
+
+func (server *rpcServer) send(message interface{}) {
+	raw, err := json.Marshal(message)
+	if err != nil {
+		fmt.Println("error encoding response:", err.Error())
+		return
+	}
+	server.writeLock.Lock()
+	defer server.writeLock.Unlock()
+	fmt.Fprintf(server.out, "Content-Length: %d\r\n\r\n%s", len(raw), raw)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestRPCFollowsRegistry(t *testing.T) {
+	useTempSettings(t)
+	repo := initRepo(t)
+	writeStore(t)
+	server := &rpcServer{out: io.Discard, watcher: newSettingsWatcher()}
+	if list, err := server.call("list", nil); err != nil || len(list.([]string)) != 0 {
+		t.Fatalf("got %v, %v with nothing registered", list, err)
+	}
+
+	writeStore(t, repo)
+	list, err := server.call("list", nil)
+	if err != nil || !reflect.DeepEqual(list, []string{repo}) {
+		t.Errorf("got list %v, %v after add, want [%s]", list, err, repo)
+	}
+	result, err := server.call("status", nil)
+	statuses := result.([]RepoStatus)
+	if err != nil || len(statuses) != 1 || statuses[0].Path != repo {
+		t.Errorf("got status %+v, %v after add, want %s", statuses, err, repo)
+	}
+
+	writeStore(t)
+	result, err = server.call("status", nil)
+	if err != nil || len(result.([]RepoStatus)) != 0 {
+		t.Errorf("got status %+v, %v after delete, want none", result, err)
+	}
+}
+
+func TestRPCUnsubscribeHandsOver(t *testing.T) {
+	server := &rpcServer{out: io.Discard}
+	first, second := make(chan struct{}), make(chan struct{})
+	server.unsubscribe(first)
+	server.unsubscribe(second)
+	select {
+	case <-first:
+	default:
+		t.Error("the first subscription is still running")
+	}
+	server.unsubscribe(nil)
+	select {
+	case <-second:
+	default:
+		t.Error("unsubscribe left the second subscription running")
+	}
+	if server.stop != nil {
+		t.Error("still subscribed")
+	}
+	// Unsubscribing twice is harmless
+	server.unsubscribe(nil)
+}
+
+func TestRPCSubscribeArgs(t *testing.T) {
+	server := &rpcServer{out: io.Discard}
+	for _, params := range []string{`{"interval": 0}`, `{"interval": "soon"}`} {
+		if _, err := server.call("subscribe", json.RawMessage(params)); err == nil || err.Code != -32602 {
+			t.Errorf("%s: got %v", params, err)
+		}
+	}
+	if server.stop != nil {
+		t.Error("subscribed with bad arguments")
+	}
+}
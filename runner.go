@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner runs the commands statuses are read from. Everything goes through
+// getCmdOutput and friends, so swapping the runner is enough to check status
+// parsing against recorded output instead of live repos.
+type Runner interface {
+	Run(timeout time.Duration, env []string, workingDir string, name string, arg ...string) (string, error)
+}
+
+var runner Runner = execRunner{}
+
+// execRunner runs commands for real
+type execRunner struct{}
+
+func (execRunner) Run(timeout time.Duration, env []string, workingDir string, name string, arg ...string) (string, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if cmdTimings != nil {
+		defer recordCmdTiming(time.Now(), name, arg)
+	}
+	cmd := exec.CommandContext(ctx, name, arg...)
+	cmd.Dir = workingDir
+	cmd.Env = env
+	// Children like ssh can hold on to stdout after git itself is killed
+	cmd.WaitDelay = time.Second
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		return "", &cmdError{Err: err, Stderr: strings.TrimSpace(stderr.String())}
+	}
+	raw := strings.TrimSpace(out.String())
+	return raw, nil
+}
+
+// fakeRunner answers commands from fixtures keyed by the command line, like
+// "git status --porcelain", instead of running them. A command without a
+// fixture fails the way a missing program would.
+type fakeRunner struct {
+	Outputs map[string]string
+	Errors  map[string]error
+	// Ran records every command asked for, in order
+	Ran  []string
+	lock sync.Mutex
+}
+
+func (runner *fakeRunner) Run(timeout time.Duration, env []string, workingDir string, name string, arg ...string) (string, error) {
+	command := strings.Join(append([]string{name}, arg...), " ")
+	runner.lock.Lock()
+	defer runner.lock.Unlock()
+	runner.Ran = append(runner.Ran, command)
+	if err, ok := runner.Errors[command]; ok {
+		return "", err
+	}
+	output, ok := runner.Outputs[command]
+	if !ok {
+		return "", &cmdError{Err: exec.ErrNotFound, Stderr: "no fixture for " + command}
+	}
+	return strings.TrimSpace(output), nil
+}
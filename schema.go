@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// printSchema prints a JSON Schema of the json output, generated from the
+// types themselves so it can't drift from what is written. New properties
+// may be added, so objects don't forbid unknown ones.
+func printSchema() {
+	schema := typeSchema(reflect.TypeOf(Report{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "git-status report"
+	schema["$defs"] = map[string]interface{}{
+		"repo_status": typeSchema(reflect.TypeOf(RepoStatus{})),
+	}
+	raw, _ := json.MarshalIndent(schema, "", "  ")
+	fmt.Println(string(raw))
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		if t.Elem() == reflect.TypeOf(RepoStatus{}) {
+			return map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/$defs/repo_status"}}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	}
+
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+		if tag[0] == "" || tag[0] == "-" {
+			continue
+		}
+		properties[tag[0]] = typeSchema(t.Field(i).Type)
+		if len(tag) == 1 {
+			required = append(required, tag[0])
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// emitScript writes a shell script with the commands that bring every flagged
+// repo current. Anything that needs a decision, like uncommitted work or an
+// unfinished rebase, is left as a comment for whoever reviews the script.
+func emitScript(w io.Writer, repos []RepoStatus) {
+	host, _ := os.Hostname()
+	fmt.Fprintln(w, "#!/bin/sh")
+	fmt.Fprintf(w, "# Generated by git-status on %s at %s, review before running\n",
+		host, clock().Format("2006-01-02 15:04 MST"))
+
+	for _, repo := range repos {
+		if !repo.ShouldReport {
+			continue
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "# %s: %s\n", repo.Name, summarizeStatus(repo))
+		commands, notes := getRemediation(repo)
+		for _, note := range notes {
+			fmt.Fprintf(w, "# %s\n", note)
+		}
+		if len(commands) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "(cd %s && %s)\n", shellQuote(repo.Path), strings.Join(commands, " && "))
+	}
+}
+
+// getRemediation lists the commands that are safe to run unattended for a
+// repo, and notes on what has to be done by hand
+func getRemediation(repo RepoStatus) (commands []string, notes []string) {
+	if repo.UnsafeOwnership {
+		return nil, []string{"owned by another user, run git-status -fix-safe-directory"}
+	}
+	if repo.MissingRefs > 0 && (mirrorBackend{}).Detect(repo.Path) {
+		return []string{"git fetch --prune"}, nil
+	}
+	if !(gitBackend{}).Detect(repo.Path) || (jjBackend{}).Detect(repo.Path) {
+		return nil, []string{"not a plain git repo, resolve by hand"}
+	}
+	if repo.Empty {
+		return nil, []string{"no commits yet, make the first one by hand"}
+	}
+	if repo.Operation != "" {
+		return nil, []string{fmt.Sprintf("%s in progress, finish or abort it first", repo.Operation)}
+	}
+	if repo.Deltas > 0 {
+		notes = append(notes, fmt.Sprintf("%d uncommitted changes, commit or stash them", repo.Deltas))
+	}
+	if repo.AuthRequired || repo.RemoteUnreachable {
+		return nil, append(notes, "remote unavailable, check it before pulling or pushing")
+	}
+	if repo.Detached != "" {
+		return nil, append(notes, "detached HEAD, check out a branch first")
+	}
+	if repo.RemoteBranchError {
+		branch, err := getCmdOutput(repo.Path, "git", "symbolic-ref", "--short", "-q", "HEAD")
+		if err != nil || branch == "" {
+			return nil, append(notes, "no branch checked out")
+		}
+		return []string{"git push -u " + shellQuote(getUpstreamRemote(repo.Path)) + " " + shellQuote(branch)}, notes
+	}
+	if repo.Unpulled > 0 && !getTagRules(repo.Path).IgnoreBehind {
+		switch {
+		case repo.Unpushed > 0 && repo.Deltas > 0:
+			return nil, append(notes, "diverged from upstream, rebase once the changes are committed")
+		case repo.Unpushed > 0:
+			commands = append(commands, "git pull --rebase")
+		default:
+			commands = append(commands, "git pull --ff-only")
+		}
+	}
+	if repo.Unpushed > 0 {
+		commands = append(commands, "git push")
+	}
+	if hasStaleBranches(repo) {
+		notes = append(notes, "many branches without an upstream, see git-status gc-branches")
+	}
+	return commands, notes
+}
+
+func shellQuote(str string) string {
+	return "'" + strings.Replace(str, "'", `'\''`, -1) + "'"
+}
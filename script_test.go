@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetRemediation(t *testing.T) {
+	repo := filepath.Join(t.TempDir(), "it's")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	useFixtures(t, nil)
+	tests := []struct {
+		name     string
+		status   RepoStatus
+		commands []string
+		notes    int
+	}{
+		{"behind", RepoStatus{Unpulled: 2}, []string{"git pull --ff-only"}, 0},
+		{"ahead", RepoStatus{Unpushed: 1}, []string{"git push"}, 0},
+		{"diverged", RepoStatus{Unpulled: 1, Unpushed: 1}, []string{"git pull --rebase", "git push"}, 0},
+		{"diverged with changes", RepoStatus{Unpulled: 1, Unpushed: 1, Deltas: 2}, nil, 2},
+		{"changes only", RepoStatus{Deltas: 2}, nil, 1},
+		{"rebasing", RepoStatus{Unpushed: 1, Operation: "rebase"}, nil, 1},
+		{"detached", RepoStatus{Detached: "abc1234"}, nil, 1},
+		{"unreachable", RepoStatus{Unpushed: 1, RemoteUnreachable: true}, nil, 1},
+		{"unsafe", RepoStatus{Unpushed: 1, UnsafeOwnership: true}, nil, 1},
+		{"empty", RepoStatus{Empty: true}, nil, 1},
+	}
+	for _, test := range tests {
+		status := test.status
+		status.Path = repo
+		commands, notes := getRemediation(status)
+		if !reflect.DeepEqual(commands, test.commands) || len(notes) != test.notes {
+			t.Errorf("%s: got %q and notes %q", test.name, commands, notes)
+		}
+	}
+}
+
+func TestEmitScript(t *testing.T) {
+	repo := filepath.Join(t.TempDir(), "it's")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	useFixtures(t, nil)
+	var buf bytes.Buffer
+	emitScript(&buf, []RepoStatus{
+		{Path: "/src/clean", Name: "clean"},
+		{Path: repo, Name: "app", Unpushed: 1, ShouldReport: true},
+	})
+	script := buf.String()
+	if !strings.HasPrefix(script, "#!/bin/sh\n") || strings.Contains(script, "clean") {
+		t.Errorf("unexpected script:\n%s", script)
+	}
+	if want := "(cd '" + strings.Replace(repo, "'", `'\''`, -1) + "' && git push)\n"; !strings.HasSuffix(script, want) {
+		t.Errorf("script doesn't end with %q:\n%s", want, script)
+	}
+}
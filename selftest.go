@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// selftestCase is a repo state built from a fresh clone, along with the
+// report line it should produce
+type selftestCase struct {
+	name  string
+	setup [][]string
+	want  string
+}
+
+const selftestDate = "2020-01-01T00:00:00Z"
+
+// selftestCases start from a clone of an origin with one commit on main. A
+// command starting with "upstream" runs in a second clone, to move origin on.
+var selftestCases = []selftestCase{
+	{
+		name: "clean",
+		want: "clean (origin/main) ✔",
+	},
+	{
+		name:  "ahead",
+		setup: [][]string{{"commit", "--allow-empty", "-qm", "local"}},
+		want:  "ahead (origin/main) ↑1",
+	},
+	{
+		name:  "behind",
+		setup: [][]string{{"upstream", "commit", "--allow-empty", "-qm", "remote"}, {"upstream", "push", "-q"}, {"fetch", "-q"}},
+		want:  "behind (origin/main) ↓1",
+	},
+	{
+		name: "diverged",
+		setup: [][]string{{"upstream", "commit", "--allow-empty", "-qm", "remote"}, {"upstream", "push", "-q"}, {"fetch", "-q"},
+			{"commit", "--allow-empty", "-qm", "local"}},
+		want: "diverged (origin/main) ↑1 ↓1",
+	},
+	{
+		name:  "dirty",
+		setup: [][]string{{"write", "README", "changed"}, {"write", "new", "new"}, {"write", "staged", "staged"}, {"add", "staged"}},
+		want:  "dirty (origin/main) +1 ~1 ?1",
+	},
+	{
+		name:  "detached",
+		setup: [][]string{{"checkout", "-q", "--detach"}},
+		want:  "detached (detached @ 995925e)",
+	},
+	{
+		name: "conflicted",
+		setup: [][]string{{"upstream", "write", "README", "theirs"}, {"upstream", "commit", "-qam", "theirs"}, {"upstream", "push", "-q"},
+			{"write", "README", "ours"}, {"commit", "-qam", "ours"}, {"fetch", "-q"}, {"merge", "-q", "origin/main"}},
+		want: "conflicted (origin/main) ↑1 ↓1 +1 ~1 merge in progress",
+	},
+}
+
+// runSelftest builds repos in known states under a temporary directory and
+// checks the report line for each, to catch changes in how git's output is
+// read. It ignores the user's config, registry and git settings.
+func runSelftest() {
+	dir, err := ioutil.TempDir("", "git-status-selftest")
+	if err != nil {
+		fmt.Println("error creating selftest dir:", err.Error())
+		os.Exit(1)
+	}
+	defer os.RemoveAll(dir)
+
+	config = newConfig()
+	stateDir = filepath.Join(dir, "state")
+	language = "en"
+	for name, value := range map[string]string{
+		"HOME":                dir,
+		"XDG_CONFIG_HOME":     dir,
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"GIT_AUTHOR_NAME":     "git-status",
+		"GIT_AUTHOR_EMAIL":    "selftest@example.com",
+		"GIT_COMMITTER_NAME":  "git-status",
+		"GIT_COMMITTER_EMAIL": "selftest@example.com",
+		// Fixed dates make commit ids, shown for a detached HEAD, the same
+		// on every run
+		"GIT_AUTHOR_DATE":    selftestDate,
+		"GIT_COMMITTER_DATE": selftestDate,
+	} {
+		os.Setenv(name, value)
+	}
+	// Stopping the clock then too keeps the commits from looking old
+	now, _ := time.Parse(time.RFC3339, selftestDate)
+	clock = func() time.Time { return now }
+
+	origin := filepath.Join(dir, "origin.git")
+	seed := filepath.Join(dir, "seed")
+	err = runSelftestSteps(dir, "", [][]string{
+		{"init", "-q", "--bare", origin},
+		{"-C", origin, "symbolic-ref", "HEAD", "refs/heads/main"},
+		{"init", "-q", seed},
+		{"-C", seed, "symbolic-ref", "HEAD", "refs/heads/main"},
+		{"-C", seed, "write", "README", "readme"},
+		{"-C", seed, "add", "README"},
+		{"-C", seed, "commit", "-qm", "initial"},
+		{"-C", seed, "push", "-q", "-u", origin, "main"},
+	})
+	if err != nil {
+		fmt.Println("error creating origin:", err.Error())
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, test := range selftestCases {
+		got, err := runSelftestCase(dir, origin, test)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("FAIL %s: %s\n", test.name, err.Error())
+		case got != test.want:
+			failed++
+			fmt.Printf("FAIL %s: got %q, want %q\n", test.name, got, test.want)
+		default:
+			fmt.Println("ok  ", test.name)
+		}
+	}
+	if failed != 0 {
+		fmt.Printf("%d of %d selftests failed\n", failed, len(selftestCases))
+		// os.Exit skips the deferred cleanup
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+}
+
+func runSelftestCase(dir string, origin string, test selftestCase) (string, error) {
+	repo := filepath.Join(dir, test.name)
+	upstream := filepath.Join(dir, test.name+"-upstream")
+	err := runSelftestSteps(dir, "", [][]string{{"clone", "-q", origin, repo}, {"clone", "-q", origin, upstream}})
+	if err != nil {
+		return "", err
+	}
+	// A failed merge is how a conflict is made, so errors only count when
+	// the repo didn't end up in the state being tested
+	runSelftestSteps(repo, upstream, test.setup)
+
+	status := getStatus(repo)
+	status.Name = test.name
+	var buf bytes.Buffer
+	printStatuses(&buf, []RepoStatus{status}, true)
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// runSelftestSteps runs git commands in dir, or in upstream for those
+// starting with "upstream". "write file text" writes a file instead.
+func runSelftestSteps(dir string, upstream string, steps [][]string) error {
+	for _, step := range steps {
+		workingDir := dir
+		if step[0] == "upstream" {
+			workingDir = upstream
+			step = step[1:]
+		}
+		if len(step) > 2 && step[0] == "-C" {
+			workingDir = step[1]
+			step = step[2:]
+		}
+		if step[0] == "write" {
+			err := ioutil.WriteFile(filepath.Join(workingDir, step[1]), []byte(step[2]+"\n"), 0644)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		_, err := getCmdOutput(workingDir, "git", step...)
+		if err != nil {
+			return fmt.Errorf("git %s: %s", strings.Join(step, " "), err.Error())
+		}
+	}
+	return nil
+}
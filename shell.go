@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// completionCommands and completionFlags are offered by the shell completion
+// that init-shell sets up
+var completionCommands = []string{
+	"-add", "-delete", "-list", "ack", "archive", "assert-clean", "bench", "completion-data",
+	"config", "digest", "gc-branches", "init-shell", "install-alias", "matrix", "merge", "note",
+	"path", "prompt", "refresh", "releases", "rpc", "run", "scan", "snooze", "tidy", "tui",
+	"unarchive", "verify", "why",
+}
+
+var completionFlags = []string{
+	"-a", "--actions", "--broken", "--check-remote", "--config", "--depth", "--dry-run",
+	"--emit-script", "--fetch", "--fetch-timeout", "--fixed-width", "--group", "--header",
+	"--hosted", "--idle-for", "--ignore-case", "--ignore-untracked", "--include-archived",
+	"--jobs", "--json", "--max-branch-width", "--max-duration", "--mock-time",
+	"--no-color", "--no-remote-checks", "--no-worktree-checks", "--pr-ready-after",
+	"--recursive", "--release", "--remote-timeout", "--runs", "--schema", "--short-branch",
+	"--skip-nested", "--sort", "--state-dir", "--store", "--tag", "--telemetry", "--theme",
+	"--title", "--watch",
+}
+
+// initShell prints the snippet to eval from a shell's startup file: a gst
+// alias, a gcd function to cd into repos, completion, and a prompt segment
+// counting flagged repos
+func initShell(shell string) {
+	if shell == "" {
+		shell = filepath.Base(os.Getenv("SHELL"))
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "git-status"
+	}
+	words := strings.Join(append(append([]string{}, completionCommands...), completionFlags...), " ")
+
+	switch shell {
+	case "bash":
+		fmt.Printf(`alias gst=%[1]s
+__git_status_prompt() { %[1]s prompt; }
+_git_status_complete() { COMPREPLY=($(compgen -W %[2]s -- "${COMP_WORDS[COMP_CWORD]}")); }
+complete -o default -F _git_status_complete git-status gst
+gcd() { local dir; dir=$(%[1]s path "$1") && cd "$dir"; }
+_gcd_complete() { COMPREPLY=($(compgen -W "$(%[1]s completion-data | cut -f1)" -- "${COMP_WORDS[COMP_CWORD]}")); }
+complete -F _gcd_complete gcd
+case "$PS1" in *__git_status_prompt*) ;; *) PS1='$(__git_status_prompt)'"$PS1" ;; esac
+`, shellQuote(exe), shellQuote(words))
+	case "zsh":
+		fmt.Printf(`alias gst=%[1]s
+__git_status_prompt() { %[1]s prompt; }
+_git_status_complete() { compadd -- %[2]s; _files; }
+(( $+functions[compdef] )) && compdef _git_status_complete git-status gst
+gcd() { local dir; dir=$(%[1]s path "$1") && cd "$dir"; }
+_gcd_complete() { compadd -- ${(f)"$(%[1]s completion-data | cut -f1)"}; }
+(( $+functions[compdef] )) && compdef _gcd_complete gcd
+setopt prompt_subst
+[[ $RPROMPT == *__git_status_prompt* ]] || RPROMPT='$(__git_status_prompt)'"$RPROMPT"
+`, shellQuote(exe), words)
+	case "fish":
+		fmt.Printf(`alias gst %[1]s
+function __git_status_prompt; %[1]s prompt; end
+complete -c git-status -c gst -a %[2]s
+function gcd; set -l dir (%[1]s path $argv[1]); and cd $dir; end
+function __gcd_names; %[1]s completion-data | cut -f1; end
+complete -c gcd -f -a '(__gcd_names)'
+functions -q fish_right_prompt; or function fish_right_prompt; __git_status_prompt; end
+`, shellQuote(exe), shellQuote(words))
+	default:
+		fmt.Println("unsupported shell, expected bash, zsh or fish:", shell)
+		os.Exit(1)
+	}
+}
+
+// printPrompt prints how many repos were flagged in the last snapshot, and
+// nothing when all is clean. It never runs git so it's fast enough for a
+// prompt, but needs snapshot.enabled and a scheduled run to stay current.
+func printPrompt() {
+	raw, err := ioutil.ReadFile(snapshotPath())
+	if err != nil {
+		return
+	}
+	var report Report
+	if json.Unmarshal(raw, &report) != nil {
+		return
+	}
+	if flagged := len(flaggedStatuses(report.Repos)); flagged > 0 {
+		fmt.Printf("⚑%d ", flagged)
+	}
+}
+
+// printPath prints where a registered repo lives, for gcd to cd into
+func printPath(names []string) {
+	if len(names) != 1 {
+		printUsage()
+		os.Exit(1)
+	}
+	path := findRegistered(names[0])
+	if path == "" {
+		fmt.Fprintln(os.Stderr, names[0], "is not registered")
+		os.Exit(1)
+	}
+	fmt.Println(path)
+}
+
+// installAlias adds a git alias, git repos unless another name is given, so
+// git-status can be run as a git subcommand without shadowing the status
+// builtin. The alias calls the binary by whatever name PATH finds it under,
+// so it keeps working across upgrades, and by its full path otherwise.
+func installAlias(names []string) {
+	name := "repos"
+	if len(names) > 1 {
+		printUsage()
+		os.Exit(1)
+	}
+	if len(names) == 1 {
+		name = names[0]
+	}
+	for _, r := range name {
+		if !(r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			fmt.Println("invalid alias name:", name)
+			os.Exit(1)
+		}
+	}
+	if commands, err := getCmdOutput(".", "git", "--list-cmds=builtins,main,others"); err == nil {
+		if contains(strings.Split(commands, "\n"), name) {
+			fmt.Println("git", name, "is already a git command, pick another name")
+			os.Exit(1)
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Println("error finding git-status:", err.Error())
+		os.Exit(1)
+	}
+	command := shellQuote(exe)
+	if isOnPath(exe) {
+		command = shellQuote(filepath.Base(exe))
+	}
+	// Marks runs through the alias so a bare one isn't taken for a
+	// mistyped git status
+	value := "!GIT_STATUS_ALIAS=" + name + " " + command
+
+	existing, err := getCmdOutput(".", "git", "config", "--global", "--get", "alias."+name)
+	switch {
+	case err == nil && existing == value:
+		fmt.Println("git", name, "is already set up")
+		return
+	case err == nil:
+		fmt.Printf("git %s is already an alias for %s\n", name, existing)
+		os.Exit(1)
+	}
+	if dryRun {
+		fmt.Printf("git config --global alias.%s %s\n", name, shellQuote(value))
+		return
+	}
+	_, err = getCmdOutput(".", "git", "config", "--global", "alias."+name, value)
+	if err != nil {
+		fmt.Println("error setting alias:", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("git %s now runs git-status\n", name)
+}
+
+// isOnPath is true when PATH finds exe under its own name. git puts its exec
+// path first for aliases, and installs its builtins there under names like
+// git-status, so a binary shadowed from there isn't found.
+func isOnPath(exe string) bool {
+	if execPath, err := getCmdOutput(".", "git", "--exec-path"); err == nil {
+		if _, err := os.Stat(filepath.Join(execPath, filepath.Base(exe))); err == nil {
+			return false
+		}
+	}
+	found, err := exec.LookPath(filepath.Base(exe))
+	if err != nil {
+		return false
+	}
+	want, err := filepath.EvalSymlinks(exe)
+	if err != nil {
+		return false
+	}
+	got, err := filepath.EvalSymlinks(found)
+	return err == nil && got == want
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Report x
+type Report struct {
+	Title     string       `json:"title,omitempty"`
+	Host      string       `json:"host"`
+	Generated time.Time    `json:"generated"`
+	Repos     []RepoStatus `json:"repos"`
+	Registry  []string     `json:"registry,omitempty"`
+}
+
+func newReport(repos []RepoStatus) Report {
+	if repos == nil {
+		// The schema promises an array
+		repos = []RepoStatus{}
+	}
+	host, _ := os.Hostname()
+	return Report{Title: config.Report.Title, Host: host, Generated: clock(), Repos: repos}
+}
+
+func snapshotPath() string {
+	if config.Snapshot.Path != "" {
+		return config.Snapshot.Path
+	}
+	return filepath.Join(stateDir, "latest.json")
+}
+
+// writeSnapshot saves the run so prompts and scripts can read the latest
+// statuses without invoking git. The file is replaced atomically so readers
+// never see a partial report.
+func writeSnapshot(repos []RepoStatus) {
+	err := checkPlaintext(snapshotPath())
+	if err != nil {
+		fmt.Println("error writing snapshot:", err.Error())
+		return
+	}
+	report := newReport(repos)
+	err = writeJSONFile(snapshotPath(), report)
+	if err != nil {
+		fmt.Println("error writing snapshot:", err.Error())
+	}
+	if config.Snapshot.History {
+		file := filepath.Join(historyDir(), report.Generated.UTC().Format("20060102T150405.000000000Z")+".json")
+		err = writeJSONFile(file, report)
+		if err != nil {
+			fmt.Println("error writing history:", err.Error())
+		}
+		pruneHistory()
+	}
+}
+
+func historyDir() string {
+	return filepath.Join(stateDir, "history")
+}
+
+// pruneHistory keeps the newest snapshot.keep_runs runs and drops anything
+// older than snapshot.keep_days, a zero turning that limit off. File names
+// are timestamps, so sorting them sorts the runs.
+func pruneHistory() {
+	files, err := filepath.Glob(filepath.Join(historyDir(), "*.json"))
+	if err != nil {
+		return
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	cutoff := time.Now().AddDate(0, 0, -config.Snapshot.KeepDays)
+	for i, file := range files {
+		expired := config.Snapshot.KeepRuns > 0 && i >= config.Snapshot.KeepRuns
+		if config.Snapshot.KeepDays > 0 {
+			if info, err := os.Stat(file); err == nil && info.ModTime().Before(cutoff) {
+				expired = true
+			}
+		}
+		if expired {
+			os.Remove(file)
+		}
+	}
+}
+
+func writeJSONFile(path string, value interface{}) error {
+	raw, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(raw, '\n'))
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	return writeFileAtomicMode(path, data, permissions)
+}
+
+// writeFileAtomicMode replaces path with data, keeping the mode of the file
+// it replaces, or using mode for a new file
+func writeFileAtomicMode(path string, data []byte, mode os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return err
+	}
+	chownToInvoker(tmp.Name())
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestZeroTimesLeftOut(t *testing.T) {
+	raw, err := json.Marshal(newReport([]RepoStatus{{Path: "/src/app", Name: "app"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"last_activity", "diverged_since", "snoozed_until"} {
+		if strings.Contains(string(raw), field) {
+			t.Errorf("%s written without a time: %s", field, raw)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// snoozeRepo leaves a repo out of reports for a while. A duration of 0
+// wakes it up again.
+func snoozeRepo(args []string) {
+	if len(args) != 2 {
+		printUsage()
+		return
+	}
+	path := findRegistered(args[0])
+	if path == "" {
+		fmt.Println(args[0], "is not registered")
+		os.Exit(1)
+	}
+	err := checkPlaintext(statePath())
+	if err != nil {
+		fmt.Println("error saving state:", err.Error())
+		os.Exit(1)
+	}
+	duration, err := parseDuration(args[1])
+	if err != nil || duration < 0 {
+		fmt.Println("invalid snooze duration:", args[1])
+		os.Exit(1)
+	}
+
+	stateLock.Lock()
+	loadState()
+	if duration == 0 {
+		delete(state.Snoozed, path)
+	} else {
+		state.Snoozed[path] = clock().Add(duration)
+	}
+	stateDirty = true
+	stateLock.Unlock()
+	saveState()
+
+	if duration == 0 {
+		fmt.Println(path, "is no longer snoozed")
+	} else {
+		fmt.Println(path, tr("snoozed until %s", formatDate(clock().Add(duration))))
+	}
+}
+
+// getSnooze is when a repo's snooze ends, or zero when it isn't snoozed.
+// Snoozes that have run out are forgotten.
+func getSnooze(path string) time.Time {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	loadState()
+	until, ok := state.Snoozed[path]
+	if !ok {
+		return time.Time{}
+	}
+	if clock().After(until) {
+		delete(state.Snoozed, path)
+		stateDirty = true
+		return time.Time{}
+	}
+	return until
+}
+
+func applySnooze(status *RepoStatus) {
+	status.SnoozedUntil = getSnooze(status.Path)
+	if !status.SnoozedUntil.IsZero() {
+		status.ShouldReport = false
+	}
+}
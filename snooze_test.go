@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplySnooze(t *testing.T) {
+	useTempSettings(t)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	previousClock := clock
+	clock = func() time.Time { return now }
+	t.Cleanup(func() { clock = previousClock })
+
+	loadState()
+	state.Snoozed["/src/asleep"] = now.Add(time.Hour)
+	state.Snoozed["/src/awake"] = now.Add(-time.Hour)
+
+	asleep := RepoStatus{Path: "/src/asleep", ShouldReport: true}
+	applySnooze(&asleep)
+	if asleep.ShouldReport || !asleep.SnoozedUntil.Equal(now.Add(time.Hour)) {
+		t.Errorf("got %+v, want it snoozed for an hour", asleep)
+	}
+	awake := RepoStatus{Path: "/src/awake", ShouldReport: true}
+	applySnooze(&awake)
+	if !awake.ShouldReport || !awake.SnoozedUntil.IsZero() {
+		t.Errorf("got %+v after the snooze ran out", awake)
+	}
+	if _, ok := state.Snoozed["/src/awake"]; ok || !stateDirty {
+		t.Error("a snooze that ran out is still remembered")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// naturalLess orders strings the way people read them, comparing runs of
+// digits by their value so repo2 sorts before repo10
+func naturalLess(a string, b string, ignoreCase bool) bool {
+	if ignoreCase {
+		lowerA, lowerB := strings.ToLower(a), strings.ToLower(b)
+		if lowerA != lowerB {
+			a, b = lowerA, lowerB
+		}
+	}
+	for a != "" && b != "" {
+		ra, _ := utf8.DecodeRuneInString(a)
+		rb, _ := utf8.DecodeRuneInString(b)
+		if unicode.IsDigit(ra) && unicode.IsDigit(rb) {
+			numA, restA := splitDigits(a)
+			numB, restB := splitDigits(b)
+			trimmedA := strings.TrimLeft(numA, "0")
+			trimmedB := strings.TrimLeft(numB, "0")
+			if len(trimmedA) != len(trimmedB) {
+				return len(trimmedA) < len(trimmedB)
+			}
+			if trimmedA != trimmedB {
+				return trimmedA < trimmedB
+			}
+			if len(numA) != len(numB) {
+				return len(numA) < len(numB)
+			}
+			a, b = restA, restB
+			continue
+		}
+		if ra != rb {
+			return ra < rb
+		}
+		a, b = a[utf8.RuneLen(ra):], b[utf8.RuneLen(rb):]
+	}
+	return len(a) < len(b)
+}
+
+func splitDigits(str string) (digits string, rest string) {
+	end := strings.IndexFunc(str, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end == -1 {
+		return str, ""
+	}
+	return str[:end], str[end:]
+}
+
+func sortByName(repos []RepoStatus) {
+	sort.SliceStable(repos, func(i, j int) bool {
+		if repos[i].Name != repos[j].Name {
+			return naturalLess(repos[i].Name, repos[j].Name, ignoreCase)
+		}
+		return naturalLess(repos[i].Path, repos[j].Path, ignoreCase)
+	})
+}
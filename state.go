@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State holds what git-status remembers between runs
+type State struct {
+	Names   map[string]CachedName `json:"names,omitempty"`
+	Acks    map[string]Ack        `json:"acks,omitempty"`
+	Snoozed map[string]time.Time  `json:"snoozed,omitempty"`
+}
+
+// CachedName is a repo name along with the mtime of the git config it was
+// read from, so a changed remote URL is picked up on the next run
+type CachedName struct {
+	Name        string    `json:"name"`
+	Remote      string    `json:"remote,omitempty"`
+	ConfigMtime time.Time `json:"config_mtime"`
+}
+
+var state State
+var stateLoaded bool
+var stateDirty bool
+var stateLock sync.Mutex
+
+func statePath() string {
+	return filepath.Join(stateDir, "state.json")
+}
+
+// loadState reads the state file the first time it is needed. A missing or
+// unreadable file just starts over with an empty state.
+func loadState() {
+	if stateLoaded {
+		return
+	}
+	stateLoaded = true
+	raw, err := ioutil.ReadFile(statePath())
+	if err == nil {
+		err = json.Unmarshal(raw, &state)
+		if err != nil {
+			fmt.Println("ignoring unreadable state:", err.Error())
+			state = State{}
+		}
+	}
+	if state.Names == nil {
+		state.Names = map[string]CachedName{}
+	}
+	if state.Acks == nil {
+		state.Acks = map[string]Ack{}
+	}
+	if state.Snoozed == nil {
+		state.Snoozed = map[string]time.Time{}
+	}
+}
+
+func saveState() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if !stateDirty || checkPlaintext(statePath()) != nil {
+		return
+	}
+	err := writeJSONFile(statePath(), state)
+	if err != nil {
+		fmt.Println("error saving state:", err.Error())
+		return
+	}
+	stateDirty = false
+}
+
+// getCachedRepoName avoids running git config for every repo on every run
+func getCachedRepoName(repo string) string {
+	repoConfig, ok := config.Repos[repo]
+	if ok && repoConfig.Alias != "" {
+		return repoConfig.Alias
+	}
+	info, err := os.Stat(filepath.Join(repo, ".git", "config"))
+	if err != nil {
+		return getRepoName(repo)
+	}
+
+	override := ""
+	if ok {
+		override = repoConfig.Remote
+	}
+
+	stateLock.Lock()
+	loadState()
+	cached, ok := state.Names[repo]
+	stateLock.Unlock()
+	if ok && cached.ConfigMtime.Equal(info.ModTime()) && cached.Remote == override {
+		return cached.Name
+	}
+
+	name := getRepoName(repo)
+	if name == "" {
+		return name
+	}
+	stateLock.Lock()
+	state.Names[repo] = CachedName{Name: name, Remote: override, ConfigMtime: info.ModTime()}
+	stateDirty = true
+	stateLock.Unlock()
+	return name
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type svnBackend struct{}
+
+func (svnBackend) Detect(dir string) bool {
+	dotsvn, err := os.Stat(path.Join(dir, ".svn"))
+	if err != nil || !dotsvn.IsDir() {
+		return false
+	}
+	return true
+}
+
+// Status computes the status of an svn checkout. Commits go straight to the
+// server, so there is never anything unpushed.
+func (svnBackend) Status(repo string) (status RepoStatus) {
+	var err error
+	status.Name = getSvnRepoName(repo)
+	status.RemoteBranch, err = getCmdOutput(repo, "svn", "info", "--show-item", "relative-url")
+	status.RemoteBranchError = err != nil
+	if config.Checks.Remote {
+		status.Unpulled, err = getSvnUnpulled(repo)
+		if err != nil {
+			status.RemoteBranchError = true
+		}
+	}
+	if config.Checks.Worktree {
+		status.Deltas = getSvnDeltas(repo)
+	}
+
+	return status
+}
+
+func getSvnRepoName(repo string) string {
+	root, err := getCmdOutput(repo, "svn", "info", "--show-item", "repos-root-url")
+	if err != nil {
+		fmt.Println("error getting repo name:", err.Error())
+		return ""
+	}
+	return path.Base(root)
+}
+
+// getSvnUnpulled counts the revisions between the working copy and the
+// server. The log range includes BASE itself when it touched this path.
+func getSvnUnpulled(repo string) (int, error) {
+	raw, err := getCmdOutput(repo, "svn", "info", "--show-item", "revision")
+	if err != nil {
+		return -1, err
+	}
+	base, err := strconv.Atoi(raw)
+	if err != nil {
+		return -1, err
+	}
+	raw, err = getNetworkCmdOutput(config.Remote.Timeout, repo, "svn", "log", "-q", "--non-interactive", "-r", "BASE:HEAD")
+	if err != nil {
+		return -1, err
+	}
+	unpulled := 0
+	for _, line := range strings.Split(raw, "\n") {
+		if !strings.HasPrefix(line, "r") {
+			continue
+		}
+		field := strings.TrimSpace(strings.SplitN(line, "|", 2)[0])
+		rev, err := strconv.Atoi(strings.TrimPrefix(field, "r"))
+		if err == nil && rev > base {
+			unpulled++
+		}
+	}
+	return unpulled, nil
+}
+
+func getSvnDeltas(repo string) int {
+	raw, err := getCmdOutput(repo, "svn", "status", "--ignore-externals")
+	if err != nil {
+		fmt.Println("error getting deltas count:", err.Error())
+		return -1
+	}
+	deltas := 0
+	for _, line := range strings.Split(raw, "\n") {
+		// Externals definitions are listed with an X but aren't local changes
+		if line == "" || strings.HasPrefix(line, "X") {
+			continue
+		}
+		deltas++
+	}
+	return deltas
+}
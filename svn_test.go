@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestGetSvnUnpulled(t *testing.T) {
+	t.Setenv("GIT_SSH_COMMAND", "")
+	t.Setenv("GIT_SSH", "")
+	fake := useFixtures(t, map[string]string{
+		"svn info --show-item revision": "12\n",
+		"svn log -q --non-interactive -r BASE:HEAD": `------------------------------------------------------------------------
+r12 | ann | 2024-01-01 10:00:00 +0000 (Mon, 01 Jan 2024)
+------------------------------------------------------------------------
+r14 | bob | 2024-01-02 10:00:00 +0000 (Tue, 02 Jan 2024)
+------------------------------------------------------------------------
+r15 | bob | 2024-01-03 10:00:00 +0000 (Wed, 03 Jan 2024)
+------------------------------------------------------------------------
+`,
+	})
+	unpulled, err := getSvnUnpulled("/repo")
+	if err != nil || unpulled != 2 {
+		t.Errorf("got %d, %v, want 2", unpulled, err)
+	}
+	// The network path looks up the repo's ssh command before running svn
+	if !contains(fake.Ran, "git config --get core.sshCommand") {
+		t.Errorf("svn log ran without the network environment: %v", fake.Ran)
+	}
+}
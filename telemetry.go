@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TelemetryRun is all that is recorded about a run: counts and the names of
+// the flags used, never paths, repo names, flag values or remotes
+type TelemetryRun struct {
+	Date     string   `json:"date"`
+	Version  string   `json:"version"`
+	OS       string   `json:"os"`
+	Repos    int      `json:"repos"`
+	Jobs     int      `json:"jobs"`
+	Duration float64  `json:"duration_seconds"`
+	Flags    []string `json:"flags,omitempty"`
+}
+
+var telemetrySetting string
+
+func telemetryPath() string {
+	return filepath.Join(stateDir, "telemetry.jsonl")
+}
+
+// setTelemetry saves --telemetry on or off to the config, so turning it off
+// is written down rather than left to the default
+func setTelemetry(setting string) {
+	enabled := setting == "on"
+	err := setConfigValue([]string{"telemetry"}, "enabled", enabled)
+	if err != nil {
+		fmt.Println("error saving config:", err.Error())
+		os.Exit(1)
+	}
+	if enabled {
+		fmt.Println("telemetry is on, runs are recorded in", telemetryPath())
+	} else {
+		fmt.Println("telemetry is off")
+	}
+}
+
+// recordTelemetry appends a run to the telemetry file when it was opted in
+// to. Nothing is sent anywhere, the file is for attaching to an issue about
+// performance.
+func recordTelemetry(repos int, duration time.Duration) {
+	if !config.Telemetry.Enabled {
+		return
+	}
+	run := TelemetryRun{
+		Date:     clock().UTC().Format("2006-01-02"),
+		Version:  version,
+		OS:       runtime.GOOS,
+		Repos:    repos,
+		Jobs:     jobs,
+		Duration: duration.Round(time.Millisecond).Seconds(),
+		Flags:    usedFlags(os.Args[1:]),
+	}
+	raw, err := json.Marshal(run)
+	if err == nil {
+		err = os.MkdirAll(stateDir, 0755)
+	}
+	if err != nil {
+		fmt.Println("error recording telemetry:", err.Error())
+		return
+	}
+	file, err := os.OpenFile(telemetryPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Println("error recording telemetry:", err.Error())
+		return
+	}
+	defer file.Close()
+	file.Write(append(raw, '\n'))
+}
+
+// usedFlags lists the names of the flags in args, without their values
+func usedFlags(args []string) []string {
+	seen := map[string]bool{}
+	var flags []string
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if len(arg) < 2 || !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.ToLower(strings.TrimLeft(flagName(arg), "-"))
+		if !seen[name] {
+			seen[name] = true
+			flags = append(flags, name)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
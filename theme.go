@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/fatih/color"
+)
+
+// Theme assigns colors to the kinds of thing the report shows
+type Theme struct {
+	Sync    []color.Attribute
+	Changes []color.Attribute
+	Error   []color.Attribute
+	Clean   []color.Attribute
+	Stale   []color.Attribute
+}
+
+// The colorblind themes keep sync, changes and errors apart by brightness and
+// along the blue-yellow axis, rather than relying on red against green
+var themes = map[string]Theme{
+	"default": {
+		Sync:    []color.Attribute{color.FgCyan},
+		Changes: []color.Attribute{color.FgYellow},
+		Error:   []color.Attribute{color.FgRed},
+		Clean:   []color.Attribute{color.FgGreen},
+		Stale:   []color.Attribute{color.FgMagenta},
+	},
+	"deuteranopia": {
+		Sync:    []color.Attribute{color.FgHiBlue},
+		Changes: []color.Attribute{color.FgYellow},
+		Error:   []color.Attribute{color.FgHiMagenta, color.Bold},
+		Clean:   []color.Attribute{color.FgCyan},
+		Stale:   []color.Attribute{color.FgHiYellow, color.Underline},
+	},
+	"protanopia": {
+		Sync:    []color.Attribute{color.FgBlue, color.Bold},
+		Changes: []color.Attribute{color.FgHiYellow},
+		Error:   []color.Attribute{color.FgHiMagenta, color.Bold, color.Underline},
+		Clean:   []color.Attribute{color.FgHiCyan},
+		Stale:   []color.Attribute{color.FgYellow, color.Underline},
+	},
+}
+
+var theme = themes["default"]
+
+func themeNames() []string {
+	return []string{"default", "deuteranopia", "protanopia"}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tuiModel is what the tui shows: the repos, the one under the cursor, the
+// name filter and, once a repo is opened, its details
+type tuiModel struct {
+	repos     []RepoStatus
+	cursor    int
+	filter    string
+	filtering bool
+	checking  bool
+	detail    []string
+	rows      int
+	cols      int
+}
+
+// tuiStatusesMsg carries the statuses from a refresh
+type tuiStatusesMsg []RepoStatus
+
+// runTUI lists every registered repo full screen. Arrows or j and k move,
+// / filters by name, enter shows a repo's changed files and unpushed
+// commits, r checks everything again and q quits.
+func runTUI() {
+	ui := tuiModel{repos: collectStatuses(), rows: 24, cols: 80}
+	program := tea.NewProgram(ui, tea.WithAltScreen(), tea.WithOutput(os.Stdout))
+	release := holdStdout()
+	_, err := program.Run()
+	release()
+	if err != nil {
+		fmt.Println("error running the tui:", err.Error())
+		os.Exit(1)
+	}
+}
+
+// holdStdout collects what checking repos prints, which would draw over the
+// screen, until release shows it after the tui is gone
+func holdStdout() (release func()) {
+	terminal := os.Stdout
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return func() {}
+	}
+	os.Stdout = writer
+	held := make(chan []byte)
+	go func() {
+		raw, _ := ioutil.ReadAll(reader)
+		held <- raw
+	}()
+	return func() {
+		os.Stdout = terminal
+		writer.Close()
+		terminal.Write(<-held)
+	}
+}
+
+func (ui tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+// refresh checks every repo again in the background
+func refresh() tea.Msg {
+	return tuiStatusesMsg(collectStatuses())
+}
+
+// visible is the repos whose name or path matches the filter
+func (ui tuiModel) visible() []RepoStatus {
+	var repos []RepoStatus
+	for _, repo := range ui.repos {
+		if strings.Contains(strings.ToLower(repo.Name+" "+repo.Path), strings.ToLower(ui.filter)) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+func (ui tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		// Some terminals report no size, the 24x80 guess stays then
+		if msg.Height > 2 && msg.Width > 0 {
+			ui.rows, ui.cols = msg.Height, msg.Width
+		}
+	case tuiStatusesMsg:
+		ui.repos = msg
+		ui.checking = false
+		ui.cursor = 0
+	case tea.KeyMsg:
+		return ui.handle(msg)
+	}
+	return ui, nil
+}
+
+// handle reacts to a key
+func (ui tuiModel) handle(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if key.Type == tea.KeyCtrlC {
+		return ui, tea.Quit
+	}
+	if ui.filtering {
+		switch key.Type {
+		case tea.KeyEnter, tea.KeyEsc:
+			ui.filtering = false
+		case tea.KeyBackspace:
+			if ui.filter != "" {
+				runes := []rune(ui.filter)
+				ui.filter = string(runes[:len(runes)-1])
+			}
+		case tea.KeyRunes, tea.KeySpace:
+			ui.filter += string(key.Runes)
+		}
+		ui.cursor = 0
+		return ui, nil
+	}
+	if ui.detail != nil {
+		switch key.String() {
+		case "q", "esc", "backspace", "enter", "left", "h":
+			ui.detail = nil
+		}
+		return ui, nil
+	}
+
+	repos := ui.visible()
+	switch key.String() {
+	case "q":
+		return ui, tea.Quit
+	case "up", "k":
+		if ui.cursor > 0 {
+			ui.cursor--
+		}
+	case "down", "j":
+		if ui.cursor < len(repos)-1 {
+			ui.cursor++
+		}
+	case "/":
+		ui.filtering = true
+	case "esc":
+		ui.filter = ""
+		ui.cursor = 0
+	case "r":
+		if !ui.checking {
+			ui.checking = true
+			return ui, refresh
+		}
+	case "enter", "right", "l":
+		if ui.cursor < len(repos) {
+			ui.detail = describeRepo(repos[ui.cursor])
+		}
+	}
+	return ui, nil
+}
+
+// View draws the whole screen
+func (ui tuiModel) View() string {
+	var lines []string
+	if ui.detail != nil {
+		lines = append(lines, ui.detail...)
+		lines = fitLines(lines, ui.rows-1)
+		lines = append(lines, "q back")
+	} else {
+		repos := ui.visible()
+		cursor := ui.cursor
+		if cursor >= len(repos) {
+			cursor = len(repos) - 1
+		}
+		if cursor < 0 {
+			cursor = 0
+		}
+		// Scroll so the cursor stays on screen
+		height := ui.rows - 2
+		first := 0
+		if cursor >= height {
+			first = cursor - height + 1
+		}
+		nameWidth := 0
+		for _, repo := range repos {
+			if len(repo.Name) > nameWidth {
+				nameWidth = len(repo.Name)
+			}
+		}
+		for i := first; i < len(repos) && i < first+height; i++ {
+			repo := repos[i]
+			line := fmt.Sprintf("  %s  %s  %s", padRight(repo.Name, nameWidth), displayBranch(repo), summarizeStatus(repo))
+			if i == cursor {
+				line = "\033[7m>" + line[1:] + "\033[0m"
+			}
+			lines = append(lines, line)
+		}
+		if len(repos) == 0 {
+			lines = append(lines, "  no repos match")
+		}
+		for len(lines) < ui.rows-1 {
+			lines = append(lines, "")
+		}
+		status := fmt.Sprintf("%d/%d repos  ↑↓ move  enter open  / filter  r refresh  q quit", len(repos), len(ui.repos))
+		if ui.checking {
+			status = "checking..."
+		} else if ui.filtering || ui.filter != "" {
+			status = "/" + ui.filter
+		}
+		lines = append(lines, status)
+	}
+	for i, line := range lines {
+		lines[i] = truncateLine(line, ui.cols)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeRepo lists what is going on in a repo for its detail view
+func describeRepo(repo RepoStatus) []string {
+	lines := []string{
+		repo.Name + " (" + displayBranch(repo) + ") " + summarizeStatus(repo),
+		repo.Path,
+	}
+	if repo.Note != "" {
+		lines = append(lines, "# "+repo.Note)
+	}
+	if !(gitBackend{}).Detect(repo.Path) {
+		return lines
+	}
+	if changed, err := getCmdOutput(repo.Path, "git", "status", "--short"); err == nil && changed != "" {
+		lines = append(lines, "", "changed files:")
+		for _, line := range porcelainLines(changed) {
+			lines = append(lines, "  "+line)
+		}
+	}
+	if repo.Unpushed > 0 && !repo.RemoteBranchError {
+		upstream := repo.RemoteBranch
+		if repo.PushBranch != "" {
+			upstream = repo.PushBranch
+		}
+		commits, err := getCmdOutput(repo.Path, "git", "log", "--format=%h %s", upstream+"..HEAD")
+		if err == nil && commits != "" {
+			lines = append(lines, "", "unpushed commits:")
+			for _, line := range strings.Split(commits, "\n") {
+				lines = append(lines, "  "+line)
+			}
+		}
+	}
+	return lines
+}
+
+// fitLines cuts lines to the screen height, saying how many were left out
+func fitLines(lines []string, height int) []string {
+	if len(lines) <= height {
+		return lines
+	}
+	hidden := len(lines) - height + 1
+	return append(lines[:height-1], fmt.Sprintf("  ... %d more", hidden))
+}
+
+// truncateLine keeps a line to the terminal width so it doesn't wrap.
+// Escape sequences only appear around whole lines and aren't counted.
+func truncateLine(line string, width int) string {
+	plain := strings.TrimSuffix(strings.TrimPrefix(line, "\033[7m"), "\033[0m")
+	runes := []rune(plain)
+	if len(runes) <= width {
+		return line
+	}
+	if plain != line {
+		return "\033[7m" + string(runes[:width]) + "\033[0m"
+	}
+	return string(runes[:width])
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDescribeRepoKeepsStatusColumns(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The runner trims the space off the first line
+	useFixtures(t, map[string]string{"git status --short": "M README\nM  main.go\n?? notes"})
+	lines := describeRepo(RepoStatus{Path: repo, Name: "app", ShouldReport: true, Deltas: 3})
+	want := []string{"changed files:", "   M README", "  M  main.go", "  ?? notes"}
+	if got := lines[len(lines)-len(want):]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHoldStdout(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	previous := os.Stdout
+	os.Stdout = file
+	defer func() { os.Stdout = previous }()
+
+	release := holdStdout()
+	fmt.Println("error getting ahead/behind")
+	if info, _ := file.Stat(); info.Size() != 0 {
+		t.Error("printed while held")
+	}
+	release()
+	if os.Stdout != file {
+		t.Error("stdout not restored")
+	}
+	if raw, _ := os.ReadFile(file.Name()); string(raw) != "error getting ahead/behind\n" {
+		t.Errorf("got %q after release", raw)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// verifyDeployments checks that checkouts used as deployments have HEAD at
+// their configured ref, from ref in their [repo] table or one of their tags,
+// and nothing changed in the working tree. Any drift exits non-zero.
+func verifyDeployments(tag string) {
+	var selected []string
+	for _, path := range registered {
+		if len(path) == 0 || strings.HasPrefix(path, commentIndicator) {
+			continue
+		}
+		if tag != "" && !contains(taggedPaths(tag), path) {
+			continue
+		}
+		if getDeployRef(path) != "" {
+			selected = append(selected, path)
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Println("no registered repos have a ref to verify, set ref in their [repo] or [tag] table")
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, path := range selected {
+		problems := verifyDeployment(path, getDeployRef(path))
+		if len(problems) == 0 {
+			continue
+		}
+		failed++
+		fmt.Printf("%s: %s\n", path, strings.Join(problems, ", "))
+	}
+	if failed != 0 {
+		fmt.Printf("%d of %d deployments drifted\n", failed, len(selected))
+		os.Exit(1)
+	}
+	fmt.Printf("%d deployments match\n", len(selected))
+}
+
+// getDeployRef is the ref a repo's HEAD should be at, if it has one
+func getDeployRef(path string) string {
+	repo, ok := config.Repos[path]
+	if !ok {
+		return ""
+	}
+	if repo.Ref != "" {
+		return repo.Ref
+	}
+	for _, tag := range repo.Tags {
+		if tagConfig, ok := config.Tags[tag]; ok && tagConfig.Ref != "" {
+			return tagConfig.Ref
+		}
+	}
+	return ""
+}
+
+func verifyDeployment(path string, ref string) []string {
+	if isUnavailable(path) {
+		return []string{"unavailable"}
+	}
+	if !(gitBackend{}).Detect(path) {
+		return []string{"not a git repo"}
+	}
+	want, err := getCmdOutput(path, "git", "rev-parse", "--verify", "-q", ref+"^{commit}")
+	if err != nil {
+		return []string{ref + " does not exist"}
+	}
+	head, err := getCmdOutput(path, "git", "rev-parse", "--verify", "-q", "HEAD")
+	if err != nil {
+		return []string{"no commits"}
+	}
+
+	var problems []string
+	if head != want {
+		behind, ahead := getAheadBehind(path, ref)
+		problems = append(problems, fmt.Sprintf("HEAD %s is not %s %s (%d ahead, %d behind)", head[:7], ref, want[:7], ahead, behind))
+	}
+	if deltas := getDeltas(path); deltas > 0 {
+		problems = append(problems, fmt.Sprintf("%d uncommitted changes", deltas))
+	}
+	if operation := getOperation(path); operation != "" {
+		problems = append(problems, operation+" in progress")
+	}
+	return problems
+}
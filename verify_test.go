@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDeployment(t *testing.T) {
+	useTempSettings(t)
+	repo := initRepo(t)
+	gitIn(t, repo, "tag", "v1")
+	if problems := verifyDeployment(repo, "v1"); len(problems) != 0 {
+		t.Errorf("got %q at the ref", problems)
+	}
+	if problems := verifyDeployment(repo, "v2"); !reflect.DeepEqual(problems, []string{"v2 does not exist"}) {
+		t.Errorf("got %q for a missing ref", problems)
+	}
+
+	commitIn(t, repo, "hotfix")
+	if err := os.WriteFile(filepath.Join(repo, "local.conf"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems := verifyDeployment(repo, "v1")
+	if len(problems) != 2 || !strings.Contains(problems[0], "is not v1") || !strings.Contains(problems[0], "(1 ahead, 0 behind)") ||
+		problems[1] != "1 uncommitted changes" {
+		t.Errorf("got %q after drifting", problems)
+	}
+	if problems := verifyDeployment(t.TempDir(), "v1"); !reflect.DeepEqual(problems, []string{"not a git repo"}) {
+		t.Errorf("got %q outside a repo", problems)
+	}
+}
+
+func TestGetDeployRef(t *testing.T) {
+	useTempSettings(t)
+	config.Repos["/srv/app"] = &RepoConfig{Ref: "release", Tags: []string{"prod"}}
+	config.Repos["/srv/api"] = &RepoConfig{Tags: []string{"web", "prod"}}
+	config.Repos["/srv/docs"] = &RepoConfig{Tags: []string{"web"}}
+	config.Tags["prod"] = &TagConfig{Ref: "origin/stable"}
+	for path, want := range map[string]string{"/srv/app": "release", "/srv/api": "origin/stable", "/srv/docs": "", "/srv/other": ""} {
+		if got := getDeployRef(path); got != want {
+			t.Errorf("%s: got %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// watchPrevious holds each repo's status from the last refresh of --watch,
+// so the table can highlight what changed. It is nil outside of --watch.
+var watchPrevious map[string]string
+
+// watchStatuses clears the screen and prints the table again every interval
+// until interrupted. Repos added or removed in the meantime, and config
+// changes, are picked up on the next refresh.
+func watchStatuses(interval time.Duration) {
+	watcher := newSettingsWatcher()
+	var lock sync.Mutex
+	for {
+		_, reloadErr := watcher.reload(&lock)
+		fmt.Print("\033[H\033[2J")
+		repos := getStatuses()
+		fmt.Printf("\nrefreshed at %s, every %s\n", clock().Format("15:04:05"), interval)
+		if reloadErr != nil {
+			fmt.Println("keeping the previous config:", reloadErr.Error())
+		}
+
+		previous := map[string]string{}
+		for _, repo := range repos {
+			previous[repo.Path] = summarizeStatus(repo)
+		}
+		watchPrevious = previous
+		time.Sleep(interval)
+	}
+}
+
+// hasChanged is true for a repo whose status differs from the last refresh
+// of --watch, including one that wasn't there before
+func hasChanged(repo RepoStatus) bool {
+	if watchPrevious == nil {
+		return false
+	}
+	before, ok := watchPrevious[repo.Path]
+	return !ok || before != summarizeStatus(repo)
+}
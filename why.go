@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// explainRepos prints, for each named repo, which checks flagged it, the
+// commits and files behind them and what to run to resolve it
+func explainRepos(names []string) {
+	if len(names) == 0 {
+		printUsage()
+		return
+	}
+	for i, name := range names {
+		if i > 0 {
+			fmt.Println()
+		}
+		path := findRegistered(name)
+		if path == "" {
+			fmt.Println(name, "is not registered")
+			continue
+		}
+		explainStatus(getStatus(path))
+	}
+}
+
+// findRegistered resolves a path, directory name or repo name to a
+// registered repo
+func findRegistered(name string) string {
+	abs, err := filepath.Abs(name)
+	if err == nil && contains(registered, abs) {
+		return abs
+	}
+	var active []string
+	for _, path := range registered {
+		if len(path) != 0 && !strings.HasPrefix(path, commentIndicator) {
+			active = append(active, path)
+		}
+	}
+	for _, path := range active {
+		if filepath.Base(path) == name {
+			return path
+		}
+	}
+	// Names come from the cache where they can, so only the repo found
+	// has its status checked
+	for _, path := range active {
+		if registeredName(path) == name {
+			return path
+		}
+	}
+	return ""
+}
+
+// registeredName is the name getStatus gives a repo, without running
+// anything but what finding the name takes
+func registeredName(path string) string {
+	if repoConfig, ok := config.Repos[path]; ok && repoConfig.Alias != "" {
+		return repoConfig.Alias
+	}
+	switch getBackend(path).(type) {
+	case nil:
+		return ""
+	case svnBackend:
+		return getSvnRepoName(path)
+	}
+	return getCachedRepoName(path)
+}
+
+func explainStatus(repo RepoStatus) {
+	fmt.Printf("%s (%s)\n", repo.Name, repo.Path)
+	if repo.Note != "" {
+		fmt.Println("  note:", repo.Note)
+	}
+	if !repo.ShouldReport {
+		fmt.Println("  nothing to report")
+		return
+	}
+	isGit := (gitBackend{}).Detect(repo.Path) && !(jjBackend{}).Detect(repo.Path)
+	branch, _ := getCmdOutput(repo.Path, "git", "symbolic-ref", "--short", "-q", "HEAD")
+
+	if repo.UnsafeOwnership {
+		fmt.Println("  owned by another user, so git refuses to read it")
+		fmt.Println("  run: git-status -fix-safe-directory")
+		return
+	}
+	if repo.MissingRefs > 0 {
+		fmt.Printf("  %d refs on %s are missing or out of date in this mirror\n", repo.MissingRefs, repo.RemoteBranch)
+		missing, err := getMissingRefs(repo.Path, repo.RemoteBranch)
+		if err == nil {
+			for _, ref := range missing {
+				fmt.Println("    " + ref)
+			}
+		}
+		fmt.Println("  run: git fetch --prune")
+	}
+	if repo.Empty {
+		fmt.Println("  no commits yet")
+		if isGit {
+			fmt.Println("  run: git add -A && git commit")
+		}
+	}
+	if repo.Operation != "" {
+		fmt.Printf("  a %s was started and not finished\n", repo.Operation)
+		if isGit {
+			fmt.Printf("  run: git %s --continue, or git %s --abort\n", repo.Operation, repo.Operation)
+		}
+	}
+	if repo.Detached != "" && repo.Operation == "" {
+		fmt.Printf("  no branch is checked out, HEAD is detached at %s\n", repo.Detached)
+		if isGit {
+			fmt.Println("  run: git switch <branch>, or git switch -c <new-branch> to keep commits made here")
+		}
+	}
+	if repo.RemoteBranchError && repo.Operation == "" {
+		fmt.Println("  the checked out branch has no upstream")
+		if isGit && branch != "" {
+			fmt.Printf("  run: git push -u %s %s\n", getUpstreamRemote(repo.Path), branch)
+		}
+	}
+	if repo.Unpushed > 0 {
+		pushBranch := repo.RemoteBranch
+		if repo.PushBranch != "" {
+			pushBranch = repo.PushBranch
+		}
+		fmt.Printf("  %d commits not pushed to %s\n", repo.Unpushed, pushBranch)
+		if isGit {
+			explainCommits(repo.Path, pushBranch+"..HEAD")
+			fmt.Println("  run: git push")
+		}
+	}
+	if repo.Unpulled > 0 && !getTagRules(repo.Path).IgnoreBehind {
+		fmt.Printf("  %d commits on %s not pulled\n", repo.Unpulled, repo.RemoteBranch)
+		if isGit {
+			explainCommits(repo.Path, "HEAD.."+repo.RemoteBranch)
+			fmt.Println("  run: git pull")
+		}
+	}
+	if repo.Deltas > 0 {
+		fmt.Printf("  %d uncommitted changes\n", repo.Deltas)
+		if repo.Staged > 0 || repo.Modified > 0 || repo.Untracked > 0 {
+			fmt.Printf("  %d staged, %d modified, %d untracked\n", repo.Staged, repo.Modified, repo.Untracked)
+		}
+		if repo.ModeChanges > 0 {
+			fmt.Printf("  %d of them only change permissions, see report.ignore_mode_changes\n", repo.ModeChanges)
+		}
+		if repo.LineEndings > 0 {
+			fmt.Printf("  %d of them only change line endings\n", repo.LineEndings)
+			fmt.Println("  run: git add --renormalize . to keep the committed endings")
+		}
+		if repo.CaseRenames > 0 {
+			fmt.Printf("  %d files were renamed in case only\n", repo.CaseRenames)
+			fmt.Println("  run: git mv on each, or rename them back")
+		}
+		if isGit {
+			raw, err := getCmdOutput(repo.Path, "git", getDeltaArgs(repo.Path)...)
+			if err == nil {
+				for _, line := range porcelainLines(raw) {
+					fmt.Println("    " + line)
+				}
+			}
+			if !repo.Empty {
+				fmt.Println("  run: git add -A && git commit, or git stash -u to set them aside")
+			}
+		}
+	}
+	if repo.Stashes > 0 {
+		fmt.Printf("  %d stashes set aside\n", repo.Stashes)
+		raw, err := getCmdOutput(repo.Path, "git", "stash", "list")
+		if err == nil {
+			for _, line := range strings.Split(raw, "\n") {
+				fmt.Println("    " + line)
+			}
+		}
+		fmt.Println("  run: git stash pop, or git stash drop once they aren't needed")
+	}
+	if repo.Permissions != "" {
+		fmt.Println("  " + repo.Permissions + ", which git will fail on")
+		fmt.Println("  run: chown -R to the right user, and chmod o-w on .git")
+	}
+	if repo.AuthRequired {
+		fmt.Println("  the remote asked for credentials that aren't available non-interactively")
+		fmt.Println("  run: git fetch, and sign in when prompted")
+	} else if repo.RemoteUnreachable {
+		fmt.Println("  the remote could not be reached")
+		fmt.Printf("  run: git ls-remote %s\n", getUpstreamRemote(repo.Path))
+	}
+	if hasStaleBranches(repo) {
+		fmt.Printf("  %d local branches have no upstream, more than the %d allowed\n",
+			repo.UntrackedBranches, config.Branches.MaxUntracked)
+		fmt.Println("  run: git-status gc-branches")
+	}
+}
+
+func explainCommits(repo string, revisions string) {
+	raw, err := getCmdOutput(repo, "git", "log", "--format=%h %s", revisions)
+	if err != nil {
+		fmt.Println("error listing commits:", err.Error())
+		return
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		fmt.Println("    " + line)
+	}
+}
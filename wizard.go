@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// shouldRunWizard is true on the first run, when there is no registry yet
+// and someone is at the terminal to answer questions
+func shouldRunWizard() bool {
+	if _, err := os.Stat(store); isRemoteStore() || !os.IsNotExist(err) {
+		return false
+	}
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		info, err := f.Stat()
+		if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// runWizard offers to find repos under the usual checkout roots and
+// register the ones picked
+func runWizard() {
+	fmt.Println("No repos are registered yet, let's find some.")
+	var roots []string
+	for _, root := range []string{"~/src", "~/go/src", "~/work", "~/code", "~/projects"} {
+		if info, err := os.Stat(expandHome(root)); err == nil && info.IsDir() {
+			roots = append(roots, expandHome(root))
+		}
+	}
+	if len(roots) != 0 {
+		fmt.Println("Found these folders that often hold checkouts:")
+		for _, root := range roots {
+			fmt.Println("  " + root)
+		}
+	}
+	fmt.Print("Other folders to search, separated by spaces (enter to skip): ")
+	answer, _ := stdin.ReadString('\n')
+	for _, root := range strings.Fields(answer) {
+		abs, err := filepath.Abs(expandHome(root))
+		if err == nil && !contains(roots, abs) {
+			roots = append(roots, abs)
+		}
+	}
+	if len(roots) == 0 {
+		fmt.Println("Nothing to search, add repos later with git-status -add")
+		return
+	}
+
+	found := discoverRepos(roots)
+	if len(found) == 0 {
+		fmt.Println("No repos found, add them later with git-status -add")
+		return
+	}
+	for i, repo := range found {
+		fmt.Printf("%3d  %s\n", i+1, repo)
+	}
+	fmt.Print("Register which? all, none, or numbers like 1 3 5-8 [all] ")
+	answer, _ = stdin.ReadString('\n')
+	picked, err := pickItems(answer, len(found))
+	if err != nil {
+		fmt.Println("error reading choice:", err.Error())
+		os.Exit(1)
+	}
+	var chosen []string
+	for _, i := range picked {
+		chosen = append(chosen, found[i])
+	}
+	if len(chosen) == 0 {
+		fmt.Println("Nothing registered, add repos later with git-status -add")
+		return
+	}
+	registerPaths(chosen)
+	fmt.Println("Registered", len(chosen), "repos")
+	fmt.Println()
+}
+
+// pickItems turns an answer like "1 3 5-8" into zero based indexes
+func pickItems(answer string, count int) ([]int, error) {
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	var picked []int
+	switch answer {
+	case "", "all":
+		for i := 0; i < count; i++ {
+			picked = append(picked, i)
+		}
+		return picked, nil
+	case "none":
+		return nil, nil
+	}
+	for _, field := range strings.Fields(strings.Replace(answer, ",", " ", -1)) {
+		bounds := strings.SplitN(field, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("not a number: %s", field)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("not a number: %s", field)
+			}
+		}
+		if first < 1 || last > count || first > last {
+			return nil, fmt.Errorf("out of range: %s", field)
+		}
+		for i := first; i <= last; i++ {
+			picked = append(picked, i-1)
+		}
+	}
+	return picked, nil
+}